@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+var (
+	actionLog = componentLogger("action")
+	proxyLog  = componentLogger("proxy")
+)
+
+const (
+	pingTimeout      = 3 * time.Second
+	defaultProxyAddr = "127.0.0.1:3128"
+)
+
+type actionFunc func(args []string) (interface{}, error)
+
+var actions = map[string]actionFunc{
+	"status":       actionStatus,
+	"usage":        actionUsage,
+	"events":       actionEvents,
+	"network":      actionNetwork,
+	"diag.export":  actionDiagExport,
+	"state":        actionState,
+	"state.clear":  actionStateClear,
+	"v2ray.list":   actionV2rayList,
+	"v2ray.switch": actionV2raySwitch,
+	"v2ray.ping":   actionV2rayPing,
+	"proc.start":   actionProcStart,
+	"proc.stop":    actionProcStop,
+	"vm.start":     actionVMStart,
+	"vm.stop":      actionVMStop,
+	"proxy.on":     actionProxyOn,
+	"proxy.off":    actionProxyOff,
+}
+
+type procStatus struct {
+	Name    string `json:"name"`
+	State   string `json:"state"`
+	Running bool   `json:"running"`
+	Health  string `json:"health,omitempty"`
+}
+
+type status struct {
+	Proxy    bool             `json:"proxy"`
+	V2ray    string           `json:"v2ray"`
+	VM       string           `json:"vm"`
+	Proc     []procStatus     `json:"proc"`
+	Profile  string           `json:"profile,omitempty"`
+	Network  string           `json:"network,omitempty"`
+	Startup  string           `json:"startup,omitempty"`
+	Schedule []scheduleStatus `json:"schedule,omitempty"`
+}
+
+type v2rayServer struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	Current bool   `json:"current"`
+	// Latency is the time to connect in milliseconds, set by v2ray.ping.
+	Latency float64 `json:"latency,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// unlockedAction is returned by the actions that wait, e.g. for the
+// dependencies of a proc. It is run after configMutex is released, since
+// a reload waiting for the lock blocks the other readers meanwhile.
+type unlockedAction func() (interface{}, error)
+
+// callAction runs the action with configMutex held for reading, then the
+// part returned to run without it.
+func callAction(name string, args []string) (interface{}, error) {
+	action, ok := actions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown action \"%s\"", name)
+	}
+	configMutex.RLock()
+	result, err := action(args)
+	configMutex.RUnlock()
+
+	if f, ok := result.(unlockedAction); ok && err == nil {
+		return f()
+	}
+	return result, err
+}
+
+// runAction runs the action, and records it in the event history unless
+// it is read-only. source tells who asked for it.
+func runAction(source, name string, args []string) (interface{}, error) {
+	if _, ok := actions[name]; !ok {
+		return nil, fmt.Errorf("unknown action \"%s\"", name)
+	}
+	actionLog.Debugf("Run action \"%s\" %q from %s\n", name, redactArgs(name, args), source)
+
+	start := time.Now()
+	result, err := callAction(name, args)
+
+	if !readOnlyActions[name] {
+		recordAction(source, name, args, start, err)
+	}
+	if err == nil {
+		recordState(source, name, args)
+	}
+	return result, err
+}
+
+func checkArgs(args []string, n int, usage string) error {
+	if len(args) != n {
+		return fmt.Errorf("usage: %s", usage)
+	}
+	return nil
+}
+
+func findProc(name string) (proc, error) {
+	for _, p := range cfg.Proc {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return proc{}, fmt.Errorf("proc \"%s\" not found in config", name)
+}
+
+func setIEProxy(enable bool, addr string) {
+	if enable {
+		enableIEProxy(addr)
+		proxyLog.Infof("IE proxy enabled with %s\n", addr)
+	} else {
+		disableIEProxy()
+		proxyLog.Infof("IE proxy disabled")
+	}
+	trayMenu.setChecked("proxy", enable)
+}
+
+var v2rayMutex sync.Mutex
+
+// selectV2ray switches v2ray to the server of the v2ray section, copied
+// from the config by the caller.
+func selectV2ray(v2ray v2rayConfig, address string) error {
+	v2rayMutex.Lock()
+	defer v2rayMutex.Unlock()
+
+	for _, v2rayItem := range v2ray.Config {
+		if v2rayItem.Address != address {
+			continue
+		}
+		id, err := resolveSecret(v2rayItem.ID)
+		if err != nil {
+			return fmt.Errorf("v2ray server \"%s\": %s", address, err)
+		}
+		v2rayLog.Infof("Switch v2ray to \"%s\"\n", v2rayItem.Address)
+		if err := switchV2ray(v2ray, v2rayItem.Address, v2rayItem.Port, id); err != nil {
+			return err
+		}
+		for _, other := range v2ray.Config {
+			trayMenu.setChecked("v2ray:"+other.Address, other.Address == address)
+		}
+		return nil
+	}
+	return fmt.Errorf("v2ray server \"%s\" not found in config", address)
+}
+
+// startProc starts p after its dependencies, unless it is not stopped,
+// e.g. already started for another proc depending on it. It waits for
+// the dependencies, so it must be called without configMutex held.
+func startProc(p proc) error {
+	if !claimProcStart(p.Name) {
+		actionLog.Infof("Proc \"%s\" is %s already\n", p.Name, procState(p.Name))
+		return nil
+	}
+	if err := startDependencies(p); err != nil {
+		setProcState(p.Name, procFailed)
+		return err
+	}
+	actionLog.Infof("Start proc \"%s\"\n", p.Name)
+	if err := p.start(); err != nil {
+		setProcState(p.Name, procFailed)
+		return fmt.Errorf("start proc \"%s\": %s", p.Name, err)
+	}
+	setProcState(p.Name, procRunning)
+	return nil
+}
+
+// stopProc stops p after the procs depending on it. procs are those of
+// the config, copied by the caller.
+func stopProc(p proc, procs []proc) {
+	stopDependents(p.Name, procs)
+	actionLog.Infof("Stop proc \"%s\"\n", p.Name)
+	setProcState(p.Name, procStopping)
+	p.stop()
+	setProcState(p.Name, procStopped)
+}
+
+// restartProc stops and starts p alone, the procs depending on it keep
+// running.
+func restartProc(p proc) error {
+	actionLog.Infof("Restart proc \"%s\"\n", p.Name)
+	setProcState(p.Name, procStopping)
+	p.stop()
+	setProcState(p.Name, procStopped)
+	return startProc(p)
+}
+
+func setVMIcon(running bool) {
+	if running && startIco != nil {
+		systray.SetIcon(startIco)
+	} else if !running && stopIco != nil {
+		systray.SetIcon(stopIco)
+	}
+}
+
+// setVMRunning starts or powers off the VM of c, a copy of the config.
+func setVMRunning(c config, running bool) {
+	setVMIcon(running)
+	if running {
+		vmLog.Infof("Start VM")
+		startVM(c.VBox)
+	} else {
+		vmLog.Infof("Poweroff VM")
+		poweroffVM(c)
+	}
+}
+
+// trayAction runs the action of a menu item. In thin client mode it is
+// sent to the running instance, except the proxy which is per user.
+func trayAction(name string, args ...string) error {
+	_, err := runTrayAction(name, args...)
+	return err
+}
+
+// runTrayAction is trayAction returning the JSON result of the action.
+func runTrayAction(name string, args ...string) (json.RawMessage, error) {
+	return runTrayActionFrom(sourceTray, name, args...)
+}
+
+// runTrayActionFrom is runTrayAction from another source than the menu.
+func runTrayActionFrom(source, name string, args ...string) (json.RawMessage, error) {
+	if !thinClient || strings.HasPrefix(name, "proxy.") {
+		r, err := runAction(source, name, args)
+		if err != nil {
+			actionLog.Errorf("Run action \"%s\" error: %s\n", name, err)
+			return nil, err
+		}
+		if r == nil {
+			return nil, nil
+		}
+		return json.Marshal(r)
+	}
+
+	switch name {
+	case "vm.start":
+		setVMIcon(true)
+	case "vm.stop":
+		setVMIcon(false)
+	}
+	result, err := callAPIFrom(source, name, args)
+	if err != nil {
+		actionLog.Errorf("Call action \"%s\" error: %s\n", name, err)
+	} else if name == "profile.apply" && len(args) == 1 {
+		applyProfileProxy(source, args[0])
+	}
+	refreshMenu()
+	return result, err
+}
+
+// refreshMenu updates the check marks from the status of the running
+// instance.
+func refreshMenu() {
+	result, err := callAPI("status", nil)
+	if err != nil {
+		actionLog.Errorf("Get status error: %s\n", err)
+		return
+	}
+	var st status
+	if err := json.Unmarshal(result, &st); err != nil {
+		actionLog.Errorf("Parse status error: %s\n", err)
+		return
+	}
+
+	for _, v2rayItem := range cfg.V2ray.Config {
+		trayMenu.setChecked("v2ray:"+v2rayItem.Address, v2rayItem.Address == st.V2ray)
+	}
+	for _, ps := range st.Proc {
+		trayMenu.setChecked("proc:"+ps.Name, procActive(ps.State))
+		trayMenu.setTitle("proc:"+ps.Name, procTitle(ps.Name, ps.Health))
+	}
+	for _, p := range cfg.Profiles {
+		trayMenu.setChecked("profile:"+p.Name, p.Name == st.Profile)
+	}
+	showStartupProgress(st.Startup)
+}
+
+func actionStatus(args []string) (interface{}, error) {
+	if err := checkArgs(args, 0, "status"); err != nil {
+		return nil, err
+	}
+
+	st := status{
+		Proxy: ieProxyEnabled(),
+		V2ray: currentV2rayConfig(),
+		VM:    vmState(),
+	}
+	startupMutex.Lock()
+	st.Startup = startupProgress
+	startupMutex.Unlock()
+	st.Profile = currentProfileName()
+	st.Network = currentNetworkName()
+	st.Schedule = scheduleStatuses()
+	for _, p := range cfg.Proc {
+		state := procState(p.Name)
+		st.Proc = append(st.Proc, procStatus{Name: p.Name, State: state, Running: state == procRunning, Health: procHealth(p.Name)})
+	}
+	return st, nil
+}
+
+func actionV2rayList(args []string) (interface{}, error) {
+	if err := checkArgs(args, 0, "v2ray list"); err != nil {
+		return nil, err
+	}
+
+	current := currentV2rayConfig()
+	servers := []v2rayServer{}
+	for _, v2rayItem := range cfg.V2ray.Config {
+		servers = append(servers, v2rayServer{
+			Address: v2rayItem.Address,
+			Port:    v2rayItem.Port,
+			Current: v2rayItem.Address == current,
+		})
+	}
+	return servers, nil
+}
+
+// actionV2rayPing lists the servers with the time to connect to each.
+func actionV2rayPing(args []string) (interface{}, error) {
+	if err := checkArgs(args, 0, "v2ray ping"); err != nil {
+		return nil, err
+	}
+	result, _ := actionV2rayList(nil)
+	servers := result.([]v2rayServer)
+
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(s *v2rayServer) {
+			defer wg.Done()
+			start := time.Now()
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.Address, strconv.Itoa(s.Port)), pingTimeout)
+			if err != nil {
+				s.Error = err.Error()
+				return
+			}
+			conn.Close()
+			s.Latency = float64(time.Since(start)) / float64(time.Millisecond)
+		}(&servers[i])
+	}
+	wg.Wait()
+	return servers, nil
+}
+
+func actionV2raySwitch(args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "v2ray switch <address>"); err != nil {
+		return nil, err
+	}
+	v2ray := cfg.V2ray
+	return unlockedAction(func() (interface{}, error) {
+		return nil, selectV2ray(v2ray, args[0])
+	}), nil
+}
+
+func actionProcStart(args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "proc start <name>"); err != nil {
+		return nil, err
+	}
+	p, err := findProc(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return unlockedAction(func() (interface{}, error) {
+		return nil, startProc(p)
+	}), nil
+}
+
+func actionProcStop(args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "proc stop <name>"); err != nil {
+		return nil, err
+	}
+	p, err := findProc(args[0])
+	if err != nil {
+		return nil, err
+	}
+	procs := cfg.Proc
+	return unlockedAction(func() (interface{}, error) {
+		stopProc(p, procs)
+		return nil, nil
+	}), nil
+}
+
+func actionVMStart(args []string) (interface{}, error) {
+	if err := checkArgs(args, 0, "vm start"); err != nil {
+		return nil, err
+	}
+	c := cfg
+	return unlockedAction(func() (interface{}, error) {
+		setVMRunning(c, true)
+		return nil, nil
+	}), nil
+}
+
+func actionVMStop(args []string) (interface{}, error) {
+	if err := checkArgs(args, 0, "vm stop"); err != nil {
+		return nil, err
+	}
+	c := cfg
+	return unlockedAction(func() (interface{}, error) {
+		setVMRunning(c, false)
+		return nil, nil
+	}), nil
+}
+
+func actionProxyOn(args []string) (interface{}, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("usage: proxy on [host:port]")
+	}
+	addr := defaultProxyAddr
+	if len(args) == 1 {
+		if _, _, err := net.SplitHostPort(args[0]); err != nil {
+			return nil, fmt.Errorf("invalid proxy address \"%s\": %s", args[0], err)
+		}
+		addr = args[0]
+	}
+	setIEProxy(true, addr)
+	return nil, nil
+}
+
+func actionProxyOff(args []string) (interface{}, error) {
+	if err := checkArgs(args, 0, "proxy off"); err != nil {
+		return nil, err
+	}
+	setIEProxy(false, "")
+	return nil, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestSwitchV2rayWhileReadingStatus(t *testing.T) {
+	defer useTestAppDir(t)()
+	defer useTestConfig(nil, "host1", "host2")()
+	cfg.V2ray.Dir = appDir
+	cfg.V2ray.ConfigFile = "config.json"
+	for i := range cfg.V2ray.Config {
+		cfg.V2ray.Config[i].Port = 443 + i
+		cfg.V2ray.Config[i].ID = "0f8e3a4c-1b2d-4e5f-8a9b-0c1d2e3f4a5b"
+	}
+	setV2rayConfig(map[string]interface{}{
+		"outbounds": []interface{}{map[string]interface{}{
+			"settings": map[string]interface{}{
+				"vnext": []interface{}{map[string]interface{}{
+					"address": "host1",
+					"port":    443.0,
+					"users":   []interface{}{map[string]interface{}{"id": cfg.V2ray.Config[0].ID}},
+				}},
+			},
+		}},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, address := range []string{"host2", "host1", "host2"} {
+			if _, err := callAction("v2ray.switch", []string{address}); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		if _, err := callAction("status", nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := callAction("v2ray.list", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if address, port, _ := currentV2rayServer(); address != "host2" || port != 444 {
+		t.Errorf("current server %s:%d, want host2:444", address, port)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(appDir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, problems := readV2rayConfig(filepath.Join(appDir, "config.json"))
+	if len(problems) > 0 {
+		t.Fatalf("saved config %s: %s", data, problems)
+	}
+	if address := v2rayVnext(c)["address"]; address != "host2" {
+		t.Errorf("saved server %v, want host2", address)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var apiLog = componentLogger("api")
+
+const defaultAPIAddr = "127.0.0.1:7788"
+
+type apiRequest struct {
+	Action string   `json:"action"`
+	Args   []string `json:"args"`
+	Source string   `json:"source,omitempty"`
+}
+
+// apiSource is sent with the actions called by this instance, for the
+// event history of the running instance.
+var apiSource = sourceTray
+
+type apiResponse struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+func apiAddr() string {
+	if cfg.API.Addr == "" {
+		return defaultAPIAddr
+	}
+	return cfg.API.Addr
+}
+
+// configEditActions write config.json. They are refused over the API of
+// the service, where a proc is an executable run as the account of the
+// service, so only who can write config.json may add one. The CLI runs
+// them itself, and the reload applies the change.
+var configEditActions = map[string]bool{
+	"proc.set":     true,
+	"proc.remove":  true,
+	"v2ray.set":    true,
+	"v2ray.remove": true,
+}
+
+func serveAPI() {
+	if err := createAPIToken(); err != nil {
+		apiLog.Errorf("Create API token error, the API is not served: %s\n", err)
+		return
+	}
+
+	ln, err := net.Listen("tcp", apiAddr())
+	if err != nil {
+		apiLog.Errorf("Control API listen error: %s\n", err)
+		return
+	}
+	apiLog.Infof("Control API listening on %s\n", ln.Addr())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/action", handleAction)
+	mux.HandleFunc("/events", handleEvents)
+	mux.HandleFunc("/log", handleLog)
+	mux.HandleFunc("/nonce", handleNonce)
+	if cfg.API.Dashboard {
+		mux.HandleFunc("/", handleDashboard)
+	}
+
+	go func() {
+		err := http.Serve(ln, localOnly(requireToken(mux)))
+		apiLog.Infof("Control API stopped: %s\n", err)
+	}()
+}
+
+// localHost tells if the request is addressed to the loopback address
+// of the API, so that pages of other sites resolving to it (DNS
+// rebinding) are refused.
+func localHost(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// localOnly refuses the requests to every route not addressed to the
+// loopback address.
+func localOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !localHost(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func handleAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// A JSON content type can not be sent by a form of another site
+	// without a CORS preflight, which is not answered.
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req apiRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, nil, err)
+		return
+	}
+	if *runAsService && configEditActions[req.Action] {
+		writeAPIResponse(w, http.StatusForbidden, nil,
+			fmt.Errorf("action \"%s\" is not allowed on the service, edit %s instead", req.Action, configFilename))
+		return
+	}
+
+	// The systray only sends "exit" to stop the VM on reboot, shutdown
+	// and exit.
+	source := req.Source
+	if !clientSources[source] || (source == sourceExit && req.Action != "vm.stop") {
+		source = sourceAPI
+	}
+	result, err := runAction(source, req.Action, req.Args)
+	if err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, nil, err)
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, result, nil)
+}
+
+// notificationLine is a line of /events with a notification of a
+// service without desktop, for the systray to show.
+type notificationLine struct {
+	Notification *notification `json:"notification"`
+}
+
+// eventLine is a line of /events as read by the client, a proc state
+// transition or a notification.
+type eventLine struct {
+	procEvent
+	Notification *notification `json:"notification"`
+}
+
+// handleEvents streams the proc state transitions, and the
+// notifications, as JSON lines until the client disconnects.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events := make(chan interface{}, 16)
+	send := func(e interface{}) {
+		select {
+		case events <- e:
+		default:
+			apiLog.Warnf("Event client too slow, drop event\n")
+		}
+	}
+	unsubscribe := subscribeProcState(func(e procEvent) { send(e) })
+	defer unsubscribe()
+	unsubscribeNotifications := subscribeNotifications(func(n notification) {
+		send(notificationLine{Notification: &n})
+	})
+	defer unsubscribeNotifications()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case e := <-events:
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeAPIResponse(w http.ResponseWriter, code int, result interface{}, err error) {
+	var resp apiResponse
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	if result != nil {
+		data, merr := json.Marshal(result)
+		if merr != nil {
+			code = http.StatusInternalServerError
+			resp.Error = merr.Error()
+		} else {
+			resp.Result = data
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(&resp)
+}
+
+func instanceRunning() bool {
+	conn, err := net.DialTimeout("tcp", apiAddr(), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func callAPI(action string, args []string) (json.RawMessage, error) {
+	return callAPIFrom(apiSource, action, args)
+}
+
+func callAPIFrom(source, action string, args []string) (json.RawMessage, error) {
+	body, err := json.Marshal(&apiRequest{Action: action, Args: args, Source: source})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+apiAddr()+"/action", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := setAuthorization(req); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 2 * time.Minute}
+	httpResp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	var resp apiResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decode response error: %s", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return resp.Result, nil
+}
+
+// followEvents calls onProc on the proc state transitions of the running
+// instance, and onNotification on its notifications, reconnecting when
+// the connection is lost.
+func followEvents(onProc func(procEvent), onNotification func(notification)) {
+	for {
+		req, err := http.NewRequest(http.MethodGet, "http://"+apiAddr()+"/events", nil)
+		if err == nil {
+			err = setAuthorization(req)
+		}
+		var resp *http.Response
+		if err == nil {
+			resp, err = http.DefaultClient.Do(req)
+		}
+		if err == nil && resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			err = fmt.Errorf("%s", resp.Status)
+		}
+		if err == nil {
+			dec := json.NewDecoder(resp.Body)
+			for {
+				var e eventLine
+				if err = dec.Decode(&e); err != nil {
+					break
+				}
+				if e.Notification != nil {
+					onNotification(*e.Notification)
+				} else {
+					onProc(e.procEvent)
+				}
+			}
+			resp.Body.Close()
+		}
+		apiLog.Errorf("Proc events of the running instance lost: %s\n", err)
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var cliLog = componentLogger("cli")
+
+var jsonOutput = flag.Bool("json", false, "Print machine-readable JSON output for subcommands")
+
+const cliUsage = `Usage: cenctl [--headless] [--json] [command]
+
+Without a command cenctl starts the systray, or runs without any UI when
+--headless is given. SIGINT and SIGTERM poweroff the VM and exit.
+
+Commands:
+  status                   Show proxy, v2ray, VM and proc status
+  usage                    Show CPU and memory of v2ray, the procs and
+                           the VM
+  network                  Show the interfaces, IPs, Wi-Fi SSIDs and
+                           default gateways, and the matching network
+  events [filter...]       Show the event history, filters are
+                           since=<duration|time>, source=<source>,
+                           action=<prefix>, failed=true and limit=<n>
+  v2ray list               List v2ray servers
+  v2ray switch <address>   Switch v2ray to the server
+  v2ray ping               List v2ray servers with their latency
+  v2ray set <address> <port> [id] [old address]
+                           Add or edit a v2ray server in config.json
+  v2ray remove <address>   Remove a v2ray server from config.json
+  proc start <name>        Start the proc
+  proc stop <name>         Stop the proc
+  proc list                List the procs of config.json
+  proc set <name> <json>   Add a proc or merge the JSON fields into it
+  proc remove <name>       Remove a proc from config.json
+  profile list             List the profiles
+  profile apply <name>     Change the proxy, v2ray, procs and VM to the
+                           profile
+  vm start                 Start the VM
+  vm stop                  Poweroff the VM
+  proxy on [host:port]     Enable IE proxy, with 127.0.0.1:3128 by
+                           default
+  proxy off                Disable IE proxy
+  state                    Show the state saved to restore on startup
+  state clear              Forget the saved state, to start from the
+                           config next time
+  secret list              List the secrets of the store
+  secret get <name>        Print the secret
+  secret set <name> [value]
+                           Store the secret, read from the terminal or
+                           stdin without the value
+  secret remove <name>     Remove the secret
+  config check             Validate config.json and the v2ray config
+  diag export [file]       Write a zip of the config with secrets
+                           redacted, the logs and the current state
+  install                  Install and start cenctl as a Windows service
+                           or a systemd user unit
+  uninstall                Stop and remove the service
+`
+
+// parseArgs parses flags appearing anywhere in args and returns the
+// remaining positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func actionName(args []string) (string, []string) {
+	if len(args) == 1 || args[0] == "status" || args[0] == "usage" || args[0] == "events" {
+		return args[0], args[1:]
+	}
+	return args[0] + "." + args[1], args[2:]
+}
+
+func runCLI(args []string) int {
+	attachConsole()
+	apiSource = sourceCLI
+
+	switch args[0] {
+	case "install":
+		return runLocal(installService)
+	case "uninstall":
+		return runLocal(uninstallService)
+	case "secret":
+		return runSecretCLI(args[1:])
+	}
+
+	name, actionArgs := actionName(args)
+	if _, ok := actions[name]; !ok {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	}
+
+	// The running instance writes the zip next to the executable, it is
+	// moved to the file asked for afterwards.
+	var diagFile string
+	if name == "diag.export" && len(actionArgs) == 1 {
+		file, err := filepath.Abs(actionArgs[0])
+		if err != nil {
+			printError(err)
+			return 1
+		}
+		diagFile, actionArgs = file, nil
+	}
+
+	var result json.RawMessage
+	var err error
+	if instanceRunning() && !configEditActions[name] {
+		result, err = callAPI(name, actionArgs)
+		if err == nil && name == "profile.apply" {
+			result, err = addProfileProxy(result, actionArgs[0])
+		}
+	} else {
+		cliLog.Infof("No running instance, run \"%s\" directly\n", name)
+		var r interface{}
+		r, err = runAction(sourceCLI, name, actionArgs)
+		if err == nil && r != nil {
+			result, err = json.Marshal(r)
+		}
+	}
+
+	if err == nil && diagFile != "" {
+		result, err = moveDiagnostics(result, diagFile)
+	}
+	if err != nil {
+		printError(err)
+		return 1
+	}
+
+	if *jsonOutput {
+		if result == nil {
+			result = json.RawMessage("{}")
+		}
+		printJSON(result)
+		return 0
+	}
+
+	switch name {
+	case "status":
+		var st status
+		json.Unmarshal(result, &st)
+		printStatus(st)
+	case "usage":
+		var ru resourceUsage
+		json.Unmarshal(result, &ru)
+		printUsage(ru)
+	case "events":
+		var events []event
+		json.Unmarshal(result, &events)
+		printEvents(events)
+	case "profile.list":
+		var profiles []profileStatus
+		json.Unmarshal(result, &profiles)
+		for _, p := range profiles {
+			mark := " "
+			if p.Current {
+				mark = "*"
+			}
+			fmt.Printf("%s %s\n", mark, p.Name)
+		}
+	case "profile.apply":
+		var steps []actionStep
+		json.Unmarshal(result, &steps)
+		if len(steps) == 0 {
+			fmt.Println("Nothing to change")
+		}
+		for _, s := range steps {
+			fmt.Println(strings.Join(append([]string{s.Action}, s.Args...), " "))
+		}
+	case "state":
+		var s runtimeState
+		json.Unmarshal(result, &s)
+		printState(s)
+	case "network":
+		var ns networkStatus
+		json.Unmarshal(result, &ns)
+		name := ns.Name
+		if name == "" {
+			name = "none of the config"
+		}
+		fmt.Printf("Network:    %s\n", name)
+		fmt.Printf("Interfaces: %s\n", strings.Join(ns.Interfaces, ", "))
+		fmt.Printf("IPs:        %s\n", strings.Join(ns.IPs, ", "))
+		fmt.Printf("SSIDs:      %s\n", strings.Join(ns.SSIDs, ", "))
+		fmt.Printf("Gateways:   %s\n", strings.Join(ns.Gateways, ", "))
+	case "diag.export":
+		var d diagResult
+		json.Unmarshal(result, &d)
+		fmt.Println(d.File)
+	case "v2ray.list":
+		var servers []v2rayServer
+		json.Unmarshal(result, &servers)
+		for _, s := range servers {
+			mark := " "
+			if s.Current {
+				mark = "*"
+			}
+			fmt.Printf("%s %s:%d\n", mark, s.Address, s.Port)
+		}
+	case "v2ray.ping":
+		var servers []v2rayServer
+		json.Unmarshal(result, &servers)
+		for _, s := range servers {
+			latency := fmt.Sprintf("%.0f ms", s.Latency)
+			if s.Error != "" {
+				latency = "unreachable: " + s.Error
+			}
+			fmt.Printf("%s:%d  %s\n", s.Address, s.Port, latency)
+		}
+	case "proc.list":
+		var procs []proc
+		json.Unmarshal(result, &procs)
+		for _, p := range procs {
+			fmt.Printf("%s  %s %s\n", p.Name, p.Path, strings.Join(p.Args, " "))
+		}
+	}
+	return 0
+}
+
+func runConfigCLI(dir string, args []string) int {
+	attachConsole()
+
+	if len(args) != 1 || args[0] != "check" {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	}
+
+	problems := checkConfig(dir)
+	if *jsonOutput {
+		if problems == nil {
+			problems = configProblems{}
+		}
+		printJSON(map[string]interface{}{"problems": problems})
+	} else if len(problems) == 0 {
+		fmt.Println("Config OK")
+	} else {
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+	}
+
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func runLocal(f func() error) int {
+	if err := f(); err != nil {
+		printError(err)
+		return 1
+	}
+	if *jsonOutput {
+		printJSON(map[string]string{})
+	}
+	return 0
+}
+
+func printError(err error) {
+	if *jsonOutput {
+		printJSON(map[string]string{"error": err.Error()})
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	}
+}
+
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func printStatus(st status) {
+	fmt.Printf("Proxy:  %s\n", onOff(st.Proxy))
+	fmt.Printf("V2ray:  %s\n", st.V2ray)
+	fmt.Printf("VM:     %s\n", st.VM)
+	if st.Profile != "" {
+		fmt.Printf("Profile: %s\n", st.Profile)
+	}
+	if st.Network != "" {
+		fmt.Printf("Network: %s\n", st.Network)
+	}
+	if st.Startup != "" {
+		fmt.Printf("Startup: %s\n", st.Startup)
+	}
+	for i, p := range st.Proc {
+		label := "Proc:"
+		if i > 0 {
+			label = ""
+		}
+		state := p.State
+		if p.Health != "" {
+			state += ", " + p.Health
+		}
+		fmt.Printf("%-7s %s %s\n", label, p.Name, state)
+	}
+	for i, s := range st.Schedule {
+		label := "Schedule:"
+		if i > 0 {
+			label = ""
+		}
+		next := "never"
+		if s.Next != nil {
+			next = s.Next.Local().Format("Mon 2006-01-02 15:04")
+		}
+		action := strings.Join(append([]string{s.Action}, s.Args...), " ")
+		line := fmt.Sprintf("%-9s %s next %s: %s", label, s.Name, next, action)
+		if s.Error != "" {
+			line += " (last run failed: " + s.Error + ")"
+		}
+		fmt.Println(line)
+	}
+}
+
+func printUsage(ru resourceUsage) {
+	line := func(label string, u *usage) {
+		if u == nil {
+			fmt.Printf("%-7s not running\n", label+":")
+			return
+		}
+		fmt.Printf("%-7s %s\n", label+":", formatUsage(u))
+	}
+	line("VM", ru.VM)
+	line("V2ray", ru.V2ray)
+	for _, p := range cfg.Proc {
+		line(p.Name, ru.procUsage(p.Name))
+	}
+}
+
+func printEvents(events []event) {
+	for _, e := range events {
+		outcome := "ok"
+		if !e.OK {
+			outcome = "failed"
+			if e.Error != "" {
+				outcome += ": " + e.Error
+			}
+		}
+		action := strings.Join(append([]string{e.Action}, e.Args...), " ")
+		fmt.Printf("%s  %-9s %s  %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Source, action, outcome)
+	}
+}
+
+func printState(s runtimeState) {
+	proxy := onOff(s.Proxy)
+	if s.Proxy && s.ProxyAddress != "" {
+		proxy += " " + s.ProxyAddress
+	}
+	fmt.Printf("Saved:   %s\n", s.Time.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("Proxy:   %s\n", proxy)
+	fmt.Printf("V2ray:   %s\n", s.V2ray)
+	fmt.Printf("VM:      %s\n", onOff(s.VM))
+	fmt.Printf("Procs:   %s\n", strings.Join(s.Procs, ", "))
+	if s.Profile != "" {
+		fmt.Printf("Profile: %s\n", s.Profile)
+	}
+}
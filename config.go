@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+type configProblem struct {
+	File    string `json:"file"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p configProblem) String() string {
+	if p.Path == "" {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.File, p.Path, p.Message)
+}
+
+type configProblems []configProblem
+
+func (ps configProblems) Error() string {
+	var lines []string
+	for _, p := range ps {
+		lines = append(lines, p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (ps *configProblems) add(file, path, format string, a ...interface{}) {
+	*ps = append(*ps, configProblem{File: file, Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+// lineCol converts a byte offset in data into a "line:col" position.
+func lineCol(data []byte, offset int64) string {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(before, '\n')
+	return fmt.Sprintf("line %d:%d", line, col)
+}
+
+func parseJSON(file string, data []byte, v interface{}) configProblems {
+	var problems configProblems
+
+	err := json.Unmarshal(data, v)
+	switch e := err.(type) {
+	case nil:
+	case *json.SyntaxError:
+		problems.add(file, "", "%s: %s", lineCol(data, e.Offset), e)
+	case *json.UnmarshalTypeError:
+		problems.add(file, e.Field, "%s: expect %s, got %s", lineCol(data, e.Offset), e.Type, e.Value)
+	default:
+		problems.add(file, "", "%s", err)
+	}
+	return problems
+}
+
+func checkHostPort(problems *configProblems, file, path, hostPort string) {
+	_, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		problems.add(file, path, "invalid address \"%s\": %s", hostPort, err)
+		return
+	}
+	checkPort(problems, file, path, port)
+}
+
+func checkPort(problems *configProblems, file, path, port string) {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		problems.add(file, path, "invalid port \"%s\"", port)
+	}
+}
+
+func checkDuration(problems *configProblems, file, path, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := time.ParseDuration(value); err != nil {
+		problems.add(file, path, "invalid duration \"%s\"", value)
+	}
+}
+
+func (c *config) validate(file string) configProblems {
+	var problems configProblems
+
+	if c.VBox.VMName == "" {
+		problems.add(file, "vbox.vm_name", "required")
+	}
+	if c.VBox.SSHHost == "" {
+		problems.add(file, "vbox.ssh_host", "required")
+	} else {
+		checkHostPort(&problems, file, "vbox.ssh_host", c.VBox.SSHHost)
+	}
+	if c.VBox.HostKey == "" {
+		problems.add(file, "vbox.host_key", "required")
+	} else if !checkSecretRef(&problems, file, "vbox.host_key", c.VBox.HostKey) {
+		if _, _, _, _, _, err := ssh.ParseKnownHosts([]byte(c.VBox.HostKey)); err != nil {
+			problems.add(file, "vbox.host_key", "invalid known_hosts line: %s", err)
+		}
+	}
+	if c.VBox.SSHKey == "" {
+		problems.add(file, "vbox.ssh_key", "required")
+	} else if !checkSecretRef(&problems, file, "vbox.ssh_key", c.VBox.SSHKey) {
+		if _, err := os.Stat(c.VBox.SSHKey); err != nil {
+			problems.add(file, "vbox.ssh_key", "%s", err)
+		}
+	}
+
+	procNames := make(map[string]int)
+	for i, p := range c.Proc {
+		path := fmt.Sprintf("proc[%d]", i)
+		if p.Name == "" {
+			problems.add(file, path+".name", "required")
+		} else if j, ok := procNames[p.Name]; ok {
+			problems.add(file, path+".name", "duplicate name \"%s\", also used by proc[%d]", p.Name, j)
+		} else {
+			procNames[p.Name] = i
+		}
+		if p.Path == "" {
+			problems.add(file, path+".path", "required")
+		}
+		validateProcEnv(&problems, file, path, p)
+		checkDuration(&problems, file, path+".stop_timeout", p.StopTimeout)
+		validateHealth(&problems, file, path+".health", p.Health)
+	}
+
+	validateDependencies(&problems, file, c.Proc)
+
+	if c.V2ray.Dir == "" {
+		problems.add(file, "v2ray.dir", "required")
+	}
+	if c.V2ray.ConfigFile == "" {
+		problems.add(file, "v2ray.config_file", "required")
+	}
+	checkDuration(&problems, file, "v2ray.stop_timeout", c.V2ray.StopTimeout)
+	addresses := make(map[string]int)
+	for i, v2rayItem := range c.V2ray.Config {
+		path := fmt.Sprintf("v2ray.config[%d]", i)
+		if v2rayItem.Address == "" {
+			problems.add(file, path+".address", "required")
+		} else if j, ok := addresses[v2rayItem.Address]; ok {
+			problems.add(file, path+".address", "duplicate address \"%s\", also used by v2ray.config[%d]", v2rayItem.Address, j)
+		} else {
+			addresses[v2rayItem.Address] = i
+		}
+		checkPort(&problems, file, path+".port", strconv.Itoa(v2rayItem.Port))
+		if !checkSecretRef(&problems, file, path+".id", v2rayItem.ID) && !uuidPattern.MatchString(v2rayItem.ID) {
+			problems.add(file, path+".id", "invalid UUID \"%s\"", v2rayItem.ID)
+		}
+	}
+
+	if c.API.Addr != "" {
+		checkHostPort(&problems, file, "api.addr", c.API.Addr)
+	}
+
+	validateMenu(&problems, file, "menu", c.Menu)
+	validateStartup(&problems, file, c.Startup)
+	validateSchedule(&problems, file, c.Schedule)
+	validateNetworks(&problems, file, c)
+	validateProfiles(&problems, file, c)
+	validateLog(&problems, file, c.Log)
+	validateEvents(&problems, file, c.Events)
+	validateNotify(&problems, file, c.Notify)
+	validateSecrets(&problems, file, c.Secrets)
+
+	return problems
+}
+
+// lookupJSON follows keys (string) and indexes (int) from v, and returns
+// the path walked so far when an element is missing.
+func lookupJSON(v interface{}, steps ...interface{}) (interface{}, string, bool) {
+	path := ""
+	for _, step := range steps {
+		switch s := step.(type) {
+		case string:
+			if path != "" {
+				path += "."
+			}
+			path += s
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, path, false
+			}
+			if v, ok = obj[s]; !ok {
+				return nil, path, false
+			}
+		case int:
+			path += fmt.Sprintf("[%d]", s)
+			arr, ok := v.([]interface{})
+			if !ok || len(arr) <= s {
+				return nil, path, false
+			}
+			v = arr[s]
+		}
+	}
+	return v, path, true
+}
+
+func validateV2rayConfig(file string, c map[string]interface{}) configProblems {
+	var problems configProblems
+
+	vnext, path, ok := lookupJSON(c, "outbounds", 0, "settings", "vnext", 0)
+	if !ok {
+		problems.add(file, path, "missing")
+		return problems
+	}
+	if _, ok := vnext.(map[string]interface{}); !ok {
+		problems.add(file, path, "expect object")
+		return problems
+	}
+
+	const vnextPath = "outbounds[0].settings.vnext[0]."
+	if address, path, ok := lookupJSON(vnext, "address"); !ok {
+		problems.add(file, vnextPath+path, "missing")
+	} else if _, ok := address.(string); !ok {
+		problems.add(file, vnextPath+path, "expect string")
+	}
+	if _, path, ok := lookupJSON(vnext, "users", 0, "id"); !ok {
+		problems.add(file, vnextPath+path, "missing")
+	}
+
+	return problems
+}
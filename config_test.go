@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testConfig = `{
+  "vbox": {
+    "vm_name": "centos",
+    "ssh_host": "127.0.0.1:2222",
+    "host_key": "[127.0.0.1]:2222 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIF6pOJlbLAL++WBjw/dwR0EWJVA+sK+LIoqRv685CCWv"
+  },
+  "proc": [
+    {"name": "frpc", "path": "frpc", "args": ["-c", "frpc.ini"], "auto_start": true}
+  ],
+  "v2ray": {
+    "dir": "v2ray",
+    "config_file": "config.json",
+    "config": [
+      {"address": "host1", "port": 443, "id": "0f8e3a4c-1b2d-4e5f-8a9b-0c1d2e3f4a5b"}
+    ]
+  }
+}`
+
+// testValidate returns the paths of the problems of testConfig, with the
+// SSH key sshKey, changed by edit.
+func testValidate(t *testing.T, sshKey string, edit func(c map[string]interface{})) []string {
+	t.Helper()
+	var c map[string]interface{}
+	if err := json.Unmarshal([]byte(testConfig), &c); err != nil {
+		t.Fatal(err)
+	}
+	c["vbox"].(map[string]interface{})["ssh_key"] = sshKey
+	edit(c)
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed config
+	problems := parseJSON("config.json", data, &parsed)
+	if len(problems) == 0 {
+		problems = parsed.validate("config.json")
+	}
+	var paths []string
+	for _, p := range problems {
+		if p.File != "config.json" {
+			t.Errorf("problem in file %q", p.File)
+		}
+		paths = append(paths, p.Path)
+	}
+	return paths
+}
+
+func TestValidatePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cenctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sshKey := filepath.Join(dir, "id_ed25519")
+	if err := ioutil.WriteFile(sshKey, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	section := func(c map[string]interface{}, keys ...interface{}) map[string]interface{} {
+		v, _, _ := lookupJSON(c, keys...)
+		return v.(map[string]interface{})
+	}
+	tests := []struct {
+		name string
+		edit func(c map[string]interface{})
+		want []string
+	}{
+		{"valid", func(c map[string]interface{}) {}, nil},
+		{"missing vm name", func(c map[string]interface{}) {
+			delete(section(c, "vbox"), "vm_name")
+		}, []string{"vbox.vm_name"}},
+		{"ssh host without port", func(c map[string]interface{}) {
+			section(c, "vbox")["ssh_host"] = "127.0.0.1"
+		}, []string{"vbox.ssh_host"}},
+		{"invalid host key", func(c map[string]interface{}) {
+			section(c, "vbox")["host_key"] = "127.0.0.1 ssh-ed25519"
+		}, []string{"vbox.host_key"}},
+		{"missing ssh key file", func(c map[string]interface{}) {
+			section(c, "vbox")["ssh_key"] = sshKey + ".missing"
+		}, []string{"vbox.ssh_key"}},
+		{"secret without name", func(c map[string]interface{}) {
+			section(c, "vbox")["ssh_key"] = "secret:"
+		}, []string{"vbox.ssh_key"}},
+		{"keys as secrets", func(c map[string]interface{}) {
+			section(c, "vbox")["host_key"] = "secret:vm/host_key"
+			section(c, "vbox")["ssh_key"] = "secret:vm/ssh_key"
+		}, nil},
+		{"proc without path", func(c map[string]interface{}) {
+			delete(section(c, "proc", 0), "path")
+		}, []string{"proc[0].path"}},
+		{"duplicate proc", func(c map[string]interface{}) {
+			c["proc"] = append(c["proc"].([]interface{}), map[string]interface{}{"name": "frpc", "path": "x"})
+		}, []string{"proc[1].name"}},
+		{"invalid stop timeout", func(c map[string]interface{}) {
+			section(c, "proc", 0)["stop_timeout"] = "10"
+		}, []string{"proc[0].stop_timeout"}},
+		{"health with two kinds", func(c map[string]interface{}) {
+			section(c, "proc", 0)["health"] = map[string]interface{}{"tcp": "127.0.0.1:7000", "http": "http://x/"}
+		}, []string{"proc[0].health"}},
+		{"invalid v2ray port and id", func(c map[string]interface{}) {
+			s := section(c, "v2ray", "config", 0)
+			s["port"] = 0
+			s["id"] = "x"
+		}, []string{"v2ray.config[0].port", "v2ray.config[0].id"}},
+		{"v2ray id as secret", func(c map[string]interface{}) {
+			section(c, "v2ray", "config", 0)["id"] = "secret:v2ray/host1"
+		}, nil},
+		{"invalid api address", func(c map[string]interface{}) {
+			c["api"] = map[string]interface{}{"addr": "127.0.0.1:0"}
+		}, []string{"api.addr"}},
+		{"schedule with unknown action", func(c map[string]interface{}) {
+			c["schedule"] = []interface{}{map[string]interface{}{"name": "n", "cron": "@daily", "action": "x"}}
+		}, []string{"schedule[0].action"}},
+		{"network without condition", func(c map[string]interface{}) {
+			c["networks"] = []interface{}{map[string]interface{}{"name": "home", "v2ray": "host1"}}
+		}, []string{"networks[0]"}},
+		{"profile with unknown proc", func(c map[string]interface{}) {
+			c["profiles"] = []interface{}{map[string]interface{}{"name": "p", "procs": []interface{}{"x"}}}
+		}, []string{"profiles[0].procs[0]"}},
+		{"wrong type", func(c map[string]interface{}) {
+			section(c, "vbox")["vm_name"] = 1
+		}, []string{"vbox.vm_name"}},
+	}
+	for _, test := range tests {
+		if got := testValidate(t, sshKey, test.edit); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: problems at %q, want %q", test.name, got, test.want)
+		}
+	}
+}
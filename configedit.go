@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+)
+
+// The actions editing the config are registered here, since the config
+// validation refers to the actions map.
+func init() {
+	actions["v2ray.set"] = actionV2raySet
+	actions["v2ray.remove"] = actionV2rayRemove
+	actions["proc.list"] = actionProcList
+	actions["proc.set"] = actionProcSet
+	actions["proc.remove"] = actionProcRemove
+}
+
+// jsonObject is a JSON object keeping the order of its keys, so that
+// config.json can be edited without reordering it.
+type jsonObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+func parseJSONObject(data []byte) (*jsonObject, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil {
+		return nil, err
+	} else if t != json.Delim('{') {
+		return nil, fmt.Errorf("expect object")
+	}
+
+	o := &jsonObject{values: make(map[string]json.RawMessage)}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := t.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		o.set(key, value)
+	}
+	return o, nil
+}
+
+func (o *jsonObject) get(key string) json.RawMessage {
+	return o.values[key]
+}
+
+func (o *jsonObject) set(key string, value json.RawMessage) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *jsonObject) remove(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// merge sets the keys of fields, a null value removes the key.
+func (o *jsonObject) merge(fields *jsonObject) {
+	for _, key := range fields.keys {
+		value := fields.values[key]
+		if string(value) == "null" {
+			o.remove(key)
+		} else {
+			o.set(key, value)
+		}
+	}
+}
+
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(o.values[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonObjectList is a JSON array of objects.
+type jsonObjectList []*jsonObject
+
+func parseJSONObjectList(data json.RawMessage) (jsonObjectList, error) {
+	var raws []json.RawMessage
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &raws); err != nil {
+			return nil, err
+		}
+	}
+	var list jsonObjectList
+	for _, raw := range raws {
+		o, err := parseJSONObject(raw)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, o)
+	}
+	return list, nil
+}
+
+// find returns the index of the object whose key has the string value,
+// or -1.
+func (l jsonObjectList) find(key, value string) int {
+	for i, o := range l {
+		var s string
+		if json.Unmarshal(o.get(key), &s) == nil && s == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func mustMarshal(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// configEditMutex serializes the edits of config.json, each reading the
+// file written by the previous one.
+var configEditMutex sync.Mutex
+
+// editConfig applies edit to config.json, and writes it if the result
+// is valid. The change is applied by the config reload.
+func editConfig(edit func(root *jsonObject) error) error {
+	configEditMutex.Lock()
+	defer configEditMutex.Unlock()
+
+	file := path.Join(appDir, configFilename)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	root, err := parseJSONObject(data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+	if err := edit(root); err != nil {
+		return err
+	}
+
+	compact, err := root.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, compact, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+
+	var c config
+	problems := parseJSON(file, out.Bytes(), &c)
+	if len(problems) == 0 {
+		problems = c.validate(file)
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, out.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	configLog.Infof("Config edited\n")
+	return nil
+}
+
+// editList edits the array of objects at the keys below root.
+func editList(root *jsonObject, keys []string, edit func(list jsonObjectList) (jsonObjectList, error)) error {
+	parents := []*jsonObject{root}
+	for _, key := range keys[:len(keys)-1] {
+		parent := parents[len(parents)-1]
+		child := &jsonObject{values: make(map[string]json.RawMessage)}
+		if raw := parent.get(key); len(raw) > 0 {
+			var err error
+			if child, err = parseJSONObject(raw); err != nil {
+				return fmt.Errorf("%s: %s", key, err)
+			}
+		}
+		parents = append(parents, child)
+	}
+
+	last := keys[len(keys)-1]
+	list, err := parseJSONObjectList(parents[len(parents)-1].get(last))
+	if err != nil {
+		return fmt.Errorf("%s: %s", last, err)
+	}
+	if list, err = edit(list); err != nil {
+		return err
+	}
+	if list == nil {
+		list = jsonObjectList{}
+	}
+	parents[len(parents)-1].set(last, mustMarshal(list))
+
+	for i := len(parents) - 1; i > 0; i-- {
+		parents[i-1].set(keys[i-1], mustMarshal(parents[i]))
+	}
+	return nil
+}
+
+func actionV2raySet(args []string) (interface{}, error) {
+	if len(args) < 2 || len(args) > 4 {
+		return nil, fmt.Errorf("usage: v2ray set <address> <port> [id] [old address]")
+	}
+	address := args[0]
+	port, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid port \"%s\"", args[1])
+	}
+	var id string
+	if len(args) > 2 {
+		id = args[2]
+	}
+	old := address
+	if len(args) > 3 && args[3] != "" {
+		old = args[3]
+	}
+
+	return nil, editConfig(func(root *jsonObject) error {
+		return editList(root, []string{"v2ray", "config"}, func(list jsonObjectList) (jsonObjectList, error) {
+			fields := &jsonObject{values: make(map[string]json.RawMessage)}
+			fields.set("address", mustMarshal(address))
+			fields.set("port", mustMarshal(port))
+			if id != "" {
+				fields.set("id", mustMarshal(id))
+			}
+
+			if i := list.find("address", old); i >= 0 {
+				list[i].merge(fields)
+				return list, nil
+			}
+			if id == "" {
+				return nil, fmt.Errorf("id required for new v2ray server \"%s\"", address)
+			}
+			return append(list, fields), nil
+		})
+	})
+}
+
+func actionV2rayRemove(args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "v2ray remove <address>"); err != nil {
+		return nil, err
+	}
+	if args[0] == currentV2rayConfig() {
+		return nil, fmt.Errorf("v2ray server \"%s\" is in use, switch to another first", args[0])
+	}
+
+	return nil, editConfig(func(root *jsonObject) error {
+		return editList(root, []string{"v2ray", "config"}, func(list jsonObjectList) (jsonObjectList, error) {
+			i := list.find("address", args[0])
+			if i < 0 {
+				return nil, fmt.Errorf("v2ray server \"%s\" not found in config", args[0])
+			}
+			return append(list[:i:i], list[i+1:]...), nil
+		})
+	})
+}
+
+// actionProcSet merges the fields, a JSON object, into the proc, which
+// is added if there is none with the name.
+func actionProcSet(args []string) (interface{}, error) {
+	if err := checkArgs(args, 2, "proc set <name> <json fields>"); err != nil {
+		return nil, err
+	}
+	fields, err := parseJSONObject([]byte(args[1]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid fields: %s", err)
+	}
+
+	return nil, editConfig(func(root *jsonObject) error {
+		return editList(root, []string{"proc"}, func(list jsonObjectList) (jsonObjectList, error) {
+			if i := list.find("name", args[0]); i >= 0 {
+				list[i].merge(fields)
+				return list, nil
+			}
+			p := &jsonObject{values: make(map[string]json.RawMessage)}
+			p.set("name", mustMarshal(args[0]))
+			p.merge(fields)
+			return append(list, p), nil
+		})
+	})
+}
+
+func actionProcRemove(args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "proc remove <name>"); err != nil {
+		return nil, err
+	}
+
+	return nil, editConfig(func(root *jsonObject) error {
+		return editList(root, []string{"proc"}, func(list jsonObjectList) (jsonObjectList, error) {
+			i := list.find("name", args[0])
+			if i < 0 {
+				return nil, fmt.Errorf("proc \"%s\" not found in config", args[0])
+			}
+			return append(list[:i:i], list[i+1:]...), nil
+		})
+	})
+}
+
+// actionProcList returns the procs of the config, with the env values
+// other than secret references redacted.
+func actionProcList(args []string) (interface{}, error) {
+	if err := checkArgs(args, 0, "proc list"); err != nil {
+		return nil, err
+	}
+
+	procs := []proc{}
+	for _, p := range cfg.Proc {
+		if len(p.Env) > 0 {
+			env := make(map[string]string)
+			for k, v := range p.Env {
+				if !isSecretRef(v) {
+					v = redacted
+				}
+				env[k] = v
+			}
+			p.Env = env
+		}
+		procs = append(procs, p)
+	}
+	return procs, nil
+}
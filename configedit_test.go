@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONObjectOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		fields string
+		want   string
+	}{
+		{"unchanged", `{"z": 1, "a": {"y": 2, "b": 3}, "m": [1, 2]}`, `{}`,
+			`{"z":1,"a":{"y":2,"b":3},"m":[1,2]}`},
+		{"replace in place", `{"z": 1, "a": 2, "m": 3}`, `{"a": "x"}`,
+			`{"z":1,"a":"x","m":3}`},
+		{"append new keys", `{"z": 1, "a": 2}`, `{"c": 3, "b": 4}`,
+			`{"z":1,"a":2,"c":3,"b":4}`},
+		{"null removes", `{"z": 1, "a": 2, "m": 3}`, `{"a": null, "x": null}`,
+			`{"z":1,"m":3}`},
+		{"remove then add", `{"z": 1, "a": 2}`, `{"z": null, "z2": 5}`,
+			`{"a":2,"z2":5}`},
+	}
+	for _, test := range tests {
+		o, err := parseJSONObject([]byte(test.data))
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		fields, err := parseJSONObject([]byte(test.fields))
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		o.merge(fields)
+		got, err := json.Marshal(o)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseJSONObjectInvalid(t *testing.T) {
+	for _, data := range []string{``, `[]`, `"x"`, `{"a": }`, `{"a": 1`} {
+		if _, err := parseJSONObject([]byte(data)); err == nil {
+			t.Errorf("%q: no error", data)
+		}
+	}
+}
+
+func TestJSONObjectListFind(t *testing.T) {
+	list, err := parseJSONObjectList(json.RawMessage(`[{"name": "a"}, {"name": "b", "path": "x"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := list.find("name", "b"); i != 1 {
+		t.Errorf("find b = %d, want 1", i)
+	}
+	if i := list.find("name", "c"); i != -1 {
+		t.Errorf("find c = %d, want -1", i)
+	}
+	if list, err := parseJSONObjectList(nil); err != nil || len(list) != 0 {
+		t.Errorf("empty list = %v, %v", list, err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// menuConfig is a user-defined menu item. Besides the title it has one
+// of separator, url, command, ssh, actions or items (a submenu).
+type menuConfig struct {
+	Title     string       `json:"title"`
+	Tooltip   string       `json:"tooltip"`
+	Separator bool         `json:"separator"`
+	URL       string       `json:"url"`
+	Command   string       `json:"command"`
+	Args      []string     `json:"args"`
+	SSH       string       `json:"ssh"`
+	Actions   []actionStep `json:"actions"`
+	Items     []menuConfig `json:"items"`
+}
+
+type actionStep struct {
+	Action string   `json:"action"`
+	Args   []string `json:"args"`
+}
+
+func validateMenu(problems *configProblems, file, path string, items []menuConfig) {
+	for i, c := range items {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+
+		kinds := 0
+		for _, set := range []bool{c.Separator, c.URL != "", c.Command != "", c.SSH != "", len(c.Actions) > 0, len(c.Items) > 0} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			problems.add(file, itemPath, "need exactly one of separator, url, command, ssh, actions or items")
+		}
+		if c.Separator {
+			continue
+		}
+		if c.Title == "" {
+			problems.add(file, itemPath+".title", "required")
+		}
+
+		if c.URL != "" {
+			if u, err := url.Parse(c.URL); err != nil || u.Scheme == "" {
+				problems.add(file, itemPath+".url", "invalid URL \"%s\"", c.URL)
+			}
+		}
+		for j, step := range c.Actions {
+			if _, ok := actions[step.Action]; !ok {
+				problems.add(file, fmt.Sprintf("%s.actions[%d].action", itemPath, j), "unknown action \"%s\"", step.Action)
+			}
+		}
+		validateMenu(problems, file, itemPath+".items", c.Items)
+	}
+}
+
+// customMenuItems builds the menu items. The ID is the index path of the
+// item in the menu config, e.g. "custom:2/0".
+func customMenuItems(items []menuConfig, prefix string) []*menuItem {
+	var menuItems []*menuItem
+	for i, c := range items {
+		id := prefix + strconv.Itoa(i)
+		item := &menuItem{ID: id, Title: c.Title, Tooltip: c.Tooltip}
+		switch {
+		case c.Separator:
+			item.Separator = true
+		case len(c.Items) > 0:
+			item.Children = customMenuItems(c.Items, id+"/")
+		default:
+			item.Action = "custom"
+			item.Args = []string{id}
+		}
+		menuItems = append(menuItems, item)
+	}
+	return menuItems
+}
+
+func findMenuConfig(id string) (menuConfig, error) {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	items := cfg.Menu
+	var c menuConfig
+	for _, part := range strings.Split(strings.TrimPrefix(id, "custom:"), "/") {
+		i, err := strconv.Atoi(part)
+		if err != nil || i < 0 || i >= len(items) {
+			return c, fmt.Errorf("menu item \"%s\" not found", id)
+		}
+		c = items[i]
+		items = c.Items
+	}
+	return c, nil
+}
+
+func runCustomItem(args []string) {
+	if len(args) != 1 {
+		return
+	}
+	c, err := findMenuConfig(args[0])
+	if err != nil {
+		menuLog.Errorf("Run menu item error: %s\n", err)
+		return
+	}
+
+	menuLog.Infof("Run menu item \"%s\"\n", c.Title)
+	switch {
+	case c.URL != "":
+		openURL(c.URL)
+	case c.Command != "":
+		runCmd(c.Command, c.Args...)
+	case c.SSH != "":
+		out, err := sshRun(configSnapshot().VBox, c.SSH)
+		if err != nil {
+			menuLog.Errorf("Run \"%s\" on VM error: %s\n%s", c.SSH, err, out)
+		} else {
+			menuLog.Infof("Run \"%s\" on VM:\n%s", c.SSH, out)
+		}
+	case len(c.Actions) > 0:
+		for _, step := range c.Actions {
+			if err := trayAction(step.Action, step.Args...); err != nil {
+				menuLog.Infof("Menu item \"%s\" stopped at action \"%s\"\n", c.Title, step.Action)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/xianghuzhao/cenctl/web"
+)
+
+func dashboardURL() string {
+	return browserURL("/")
+}
+
+// handleDashboard serves the embedded web dashboard, which drives the
+// control API.
+func handleDashboard(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if name == "" {
+		name = "index.html"
+	}
+	data, err := web.Asset(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Write(data)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	logFilename     = "cenctl.log"
+	defaultLogLines = 200
+	redacted        = "<redacted>"
+)
+
+var diagLog = componentLogger("diag")
+
+func logPath() string {
+	return path.Join(appDir, logFilename)
+}
+
+// logFiles returns the log file and its rotated backups.
+func logFiles() []string {
+	files := []string{logPath()}
+	backups, _ := filepath.Glob(logPath() + ".*")
+	return append(files, backups...)
+}
+
+// tailLog returns the last n lines of the log file.
+func tailLog(n int) ([]string, error) {
+	f, err := os.Open(logPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// isSecretKey tells if the value of a JSON key is a credential: the
+// v2ray user ids and passwords, and the proc environment.
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range []string{"password", "token", "secret", "private"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return key == "id" || key == "pass"
+}
+
+// redactJSON replaces the credentials in decoded JSON, with the proc
+// env and args, which may hold tokens. Secret references are kept, since
+// they are only names. The values replaced are added to found, if not
+// nil, but the args: most are plain options, too common to be replaced
+// in the logs.
+func redactJSON(v interface{}, secret bool, found map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if key == "args" {
+				out[key] = redactJSON(value, true, nil)
+				continue
+			}
+			out[key] = redactJSON(value, secret || isSecretKey(key) || key == "env", found)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = redactJSON(value, secret, found)
+		}
+		return out
+	case string:
+		if secret && !isSecretRef(v) {
+			if found != nil {
+				found[v] = true
+			}
+			return redacted
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func redactFile(file string, found map[string]bool) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return []byte(fmt.Sprintf("not valid JSON, left out: %s\n", err)), nil
+	}
+	return json.MarshalIndent(redactJSON(v, false, found), "", "  ")
+}
+
+// minRedactedLength is the length of the shortest value replaced in the
+// logs, shorter ones would hide too much of them.
+const minRedactedLength = 4
+
+// logSecrets adds to secrets the values of the env files of the procs
+// and the API token, replaced in the logs with the credentials of the
+// configs.
+func logSecrets(secrets map[string]bool, procs []proc) {
+	for _, p := range procs {
+		if p.EnvFile == "" {
+			continue
+		}
+		env, _ := parseEnvFile(envFilePath(p.EnvFile))
+		for _, kv := range env {
+			secrets[kv[strings.Index(kv, "=")+1:]] = true
+		}
+	}
+	if token, err := readAPIToken(); err == nil {
+		secrets[token] = true
+	}
+}
+
+// redactLog replaces in the log the given values and the secrets
+// resolved.
+func redactLog(data []byte, secrets map[string]bool) []byte {
+	var values []string
+	for s := range secrets {
+		values = append(values, s)
+	}
+	values = append(values, resolvedSecretValues()...)
+	// The longest first, a value may contain another.
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	var pairs []string
+	for _, s := range values {
+		if len(s) >= minRedactedLength {
+			pairs = append(pairs, s, redacted)
+		}
+	}
+	if len(pairs) == 0 {
+		return data
+	}
+	return []byte(strings.NewReplacer(pairs...).Replace(string(data)))
+}
+
+// writeDiagnostics writes a zip of the redacted configs, the logs and
+// the current state.
+func writeDiagnostics(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	z := zip.NewWriter(f)
+	add := func(name string, data []byte) error {
+		w, err := z.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	files := map[string]string{
+		configFilename: path.Join(appDir, configFilename),
+		"v2ray.json":   path.Join(cfg.V2ray.Dir, cfg.V2ray.ConfigFile),
+	}
+	secrets := make(map[string]bool)
+	for name, src := range files {
+		data, err := redactFile(src, secrets)
+		if err != nil {
+			data = []byte(err.Error() + "\n")
+		}
+		if err := add(name, data); err != nil {
+			return err
+		}
+	}
+
+	logSecrets(secrets, cfg.Proc)
+	for _, src := range logFiles() {
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			continue
+		}
+		if err := add("log/"+filepath.Base(src), redactLog(data, secrets)); err != nil {
+			return err
+		}
+	}
+
+	st, _ := actionStatus(nil)
+	state := map[string]interface{}{
+		"time":   time.Now(),
+		"status": st,
+		"usage":  currentUsage(),
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := add("state.json", data); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+type diagResult struct {
+	File string `json:"file"`
+}
+
+func actionDiagExport(args []string) (interface{}, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("usage: diag export [file]")
+	}
+	// The file is written as the account of the running instance, so
+	// only a new zip next to the executable is allowed.
+	file := path.Join(appDir, "cenctl-diagnostics-"+time.Now().Format("20060102-150405")+".zip")
+	if len(args) == 1 {
+		name := args[0]
+		if name != filepath.Base(name) || filepath.Ext(name) != ".zip" {
+			return nil, fmt.Errorf("invalid file \"%s\", expect the name of a .zip, written next to the executable", name)
+		}
+		file = path.Join(appDir, name)
+	}
+	if err := writeDiagnostics(file); err != nil {
+		return nil, fmt.Errorf("write diagnostics: %s", err)
+	}
+	diagLog.Infof("Diagnostics written to %s\n", file)
+	return diagResult{File: file}, nil
+}
+
+// moveDiagnostics moves the zip written by the running instance to the
+// file asked for on the command line.
+func moveDiagnostics(result json.RawMessage, file string) (json.RawMessage, error) {
+	var d diagResult
+	if err := json.Unmarshal(result, &d); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(d.File, file); err != nil {
+		data, err := ioutil.ReadFile(d.File)
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(file, data, 0644); err != nil {
+			return nil, err
+		}
+		os.Remove(d.File)
+	}
+	return json.Marshal(diagResult{File: file})
+}
+
+// handleLog serves a page with the end of the log, reloaded every few
+// seconds.
+func handleLog(w http.ResponseWriter, r *http.Request) {
+	n := defaultLogLines
+	if s := r.URL.Query().Get("n"); s != "" {
+		if i, err := strconv.Atoi(s); err == nil && i > 0 {
+			n = i
+		}
+	}
+	lines, err := tailLog(n)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta http-equiv="refresh" content="5">
+<title>CenCtl log</title>
+<style>body{margin:0;background:#1e1e1e;color:#ddd}pre{margin:8px;font:12px monospace;white-space:pre-wrap}</style>
+</head><body onload="window.scrollTo(0,document.body.scrollHeight)"><pre>`)
+	for _, line := range lines {
+		fmt.Fprintln(w, html.EscapeString(line))
+	}
+	fmt.Fprint(w, "</pre></body></html>\n")
+}
+
+// exportDiagnostics is run from the menu, and shows the folder of the
+// zip when done.
+func exportDiagnostics() {
+	result, err := runTrayAction("diag.export")
+	if err != nil {
+		showError("CenCtl diagnostics", err.Error())
+		return
+	}
+	var d diagResult
+	if err := json.Unmarshal(result, &d); err != nil {
+		diagLog.Errorf("Parse diagnostics result error: %s\n", err)
+		return
+	}
+	openURL(filepath.Dir(d.File))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedactLog(t *testing.T) {
+	defer useTestAppDir(t)()
+	if err := ioutil.WriteFile(filepath.Join(appDir, "app.env"), []byte("DB_PASS=envfilepass\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tokenMutex.Lock()
+	old := apiToken
+	apiToken = "0123456789abcdef"
+	tokenMutex.Unlock()
+	defer func() {
+		tokenMutex.Lock()
+		apiToken = old
+		tokenMutex.Unlock()
+	}()
+
+	config := map[string]interface{}{
+		"proc": []interface{}{map[string]interface{}{
+			"name": "app",
+			"args": []interface{}{"--verbose", "--port", "8080"},
+			"env":  map[string]interface{}{"API_KEY": "envkey123", "REF": "secret:app/key"},
+		}},
+		"v2ray": map[string]interface{}{"id": "b831381d-6324-4d53-ad4f-8cda48b30811"},
+	}
+	secrets := make(map[string]bool)
+	redactJSON(config, false, secrets)
+	logSecrets(secrets, []proc{{Name: "app", EnvFile: "app.env"}})
+
+	log := "start app --verbose --port 8080 API_KEY=envkey123 DB_PASS=envfilepass " +
+		"id=b831381d-6324-4d53-ad4f-8cda48b30811 token=0123456789abcdef ref=secret:app/key\n"
+	want := "start app --verbose --port 8080 API_KEY=<redacted> DB_PASS=<redacted> " +
+		"id=<redacted> token=<redacted> ref=secret:app/key\n"
+	if got := string(redactLog([]byte(log), secrets)); got != want {
+		t.Errorf("redactLog:\n got %s want %s", got, want)
+	}
+}
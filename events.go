@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	eventsFilename          = "events.jsonl"
+	defaultEventsMaxSize    = 10
+	defaultEventsMaxBackups = 5
+	defaultEventsLimit      = 50
+)
+
+// eventsConfig is the "events" section of config.json. MaxSize is in
+// MB.
+type eventsConfig struct {
+	MaxSize    int `json:"max_size"`
+	MaxBackups int `json:"max_backups"`
+}
+
+func validateEvents(problems *configProblems, file string, c eventsConfig) {
+	if c.MaxSize < 0 {
+		problems.add(file, "events.max_size", "must not be negative")
+	}
+	if c.MaxBackups < 0 {
+		problems.add(file, "events.max_backups", "must not be negative")
+	}
+}
+
+// Sources of the events. The API clients may send the ones in
+// clientSources, the others are recorded as "api".
+const (
+	sourceTray      = "tray"
+	sourceCLI       = "cli"
+	sourceAPI       = "api"
+	sourceDashboard = "dashboard"
+	sourceStartup   = "startup"
+	sourceHealth    = "health"
+	sourceConfig    = "config"
+	sourceMonitor   = "monitor"
+	sourceSchedule  = "schedule"
+	sourceNetwork   = "network"
+	// sourceExit stops the VM on reboot, shutdown and exit, which is not
+	// recorded in the state so that the VM is started again next time.
+	sourceExit = "exit"
+)
+
+var clientSources = map[string]bool{
+	sourceTray:      true,
+	sourceCLI:       true,
+	sourceDashboard: true,
+	sourceExit:      true,
+}
+
+// userSources are the sources of the choices of the user, saved in the
+// state.
+var userSources = map[string]bool{
+	sourceTray:      true,
+	sourceCLI:       true,
+	sourceAPI:       true,
+	sourceDashboard: true,
+}
+
+// readOnlyActions are not recorded, they change nothing and are polled.
+var readOnlyActions = map[string]bool{
+	"status":       true,
+	"usage":        true,
+	"events":       true,
+	"network":      true,
+	"v2ray.list":   true,
+	"v2ray.ping":   true,
+	"proc.list":    true,
+	"state":        true,
+	"profile.list": true,
+}
+
+// event is a line of events.jsonl: an action, who ran it and how it
+// ended.
+type event struct {
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`
+	Action   string    `json:"action"`
+	Args     []string  `json:"args,omitempty"`
+	OK       bool      `json:"ok"`
+	Error    string    `json:"error,omitempty"`
+	Duration float64   `json:"duration_ms,omitempty"`
+}
+
+var (
+	eventsMutex sync.Mutex
+	eventLog    = componentLogger("events")
+)
+
+// eventsMaxSize and eventsMaxBackups are set by configureEvents.
+var (
+	eventsMaxSize    int64 = defaultEventsMaxSize << 20
+	eventsMaxBackups       = defaultEventsMaxBackups
+)
+
+// configureEvents applies the events section of the config, also on
+// reload.
+func configureEvents(c eventsConfig) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	eventsMaxSize = defaultEventsMaxSize << 20
+	if c.MaxSize > 0 {
+		eventsMaxSize = int64(c.MaxSize) << 20
+	}
+	eventsMaxBackups = defaultEventsMaxBackups
+	if c.MaxBackups > 0 {
+		eventsMaxBackups = c.MaxBackups
+	}
+}
+
+func eventsPath() string {
+	return path.Join(appDir, eventsFilename)
+}
+
+// eventFiles returns events.jsonl.N ... events.jsonl.1 and events.jsonl,
+// oldest first.
+func eventFiles() []string {
+	var files []string
+	for i := eventsMaxBackups; i > 0; i-- {
+		files = append(files, fmt.Sprintf("%s.%d", eventsPath(), i))
+	}
+	return append(files, eventsPath())
+}
+
+// rotateEvents moves events.jsonl to events.jsonl.1, shifting the
+// older ones, and removes the generations past eventsMaxBackups.
+func rotateEvents() error {
+	file := eventsPath()
+	for i := eventsMaxBackups + 1; ; i++ {
+		if err := os.Remove(fmt.Sprintf("%s.%d", file, i)); err != nil {
+			break
+		}
+	}
+	for i := eventsMaxBackups; i > 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", file, i-1), fmt.Sprintf("%s.%d", file, i))
+	}
+	return os.Rename(file, file+".1")
+}
+
+// redactArgs hides the credentials in the arguments of an action.
+func redactArgs(action string, args []string) []string {
+	args = append([]string(nil), args...)
+	switch action {
+	case "v2ray.set":
+		if len(args) > 2 && args[2] != "" && !isSecretRef(args[2]) {
+			args[2] = redacted
+		}
+	case "proc.set":
+		if len(args) > 1 {
+			var v interface{}
+			if json.Unmarshal([]byte(args[1]), &v) == nil {
+				if data, err := json.Marshal(redactJSON(v, false, nil)); err == nil {
+					args[1] = string(data)
+				}
+			}
+		}
+	}
+	return args
+}
+
+// recordEvent appends the event to events.jsonl, which is rotated to
+// events.jsonl.1, events.jsonl.2, ... when it gets too large.
+func recordEvent(e event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Args = redactArgs(e.Action, e.Args)
+	data, err := json.Marshal(&e)
+	if err != nil {
+		eventLog.Errorf("Marshal event error: %s\n", err)
+		return
+	}
+
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+
+	file := eventsPath()
+	if info, err := os.Stat(file); err == nil && info.Size() > eventsMaxSize {
+		if err := rotateEvents(); err != nil {
+			eventLog.Errorf("Rotate events file error: %s\n", err)
+		}
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		eventLog.Errorf("Open events file error: %s\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		eventLog.Errorf("Write event error: %s\n", err)
+	}
+}
+
+func recordAction(source, name string, args []string, start time.Time, err error) {
+	e := event{
+		Time:     start,
+		Source:   source,
+		Action:   name,
+		Args:     args,
+		OK:       err == nil,
+		Duration: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	recordEvent(e)
+}
+
+func recordProcEvent(e procEvent) {
+	if e.Prev == "" {
+		return
+	}
+	recordEvent(event{
+		Time:   e.Time,
+		Source: sourceMonitor,
+		Action: "proc.state",
+		Args:   []string{e.Name, e.Prev, e.State},
+		OK:     e.State != procFailed,
+	})
+}
+
+// eventFilter selects events by time, source, action prefix and
+// outcome.
+type eventFilter struct {
+	since  time.Time
+	source string
+	action string
+	failed bool
+	limit  int
+}
+
+// parseEventFilter reads key=value arguments: since (a duration back
+// from now or an RFC 3339 time), source, action, failed and limit.
+func parseEventFilter(args []string) (eventFilter, error) {
+	f := eventFilter{limit: defaultEventsLimit}
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return f, fmt.Errorf("invalid filter \"%s\", expect key=value", arg)
+		}
+		key, value := parts[0], parts[1]
+		switch key {
+		case "since":
+			if d, err := time.ParseDuration(value); err == nil {
+				f.since = time.Now().Add(-d)
+			} else if t, err := time.Parse(time.RFC3339, value); err == nil {
+				f.since = t
+			} else {
+				return f, fmt.Errorf("invalid since \"%s\", expect a duration or an RFC 3339 time", value)
+			}
+		case "source":
+			f.source = value
+		case "action":
+			f.action = value
+		case "failed":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return f, fmt.Errorf("invalid failed \"%s\"", value)
+			}
+			f.failed = b
+		case "limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return f, fmt.Errorf("invalid limit \"%s\"", value)
+			}
+			f.limit = n
+		default:
+			return f, fmt.Errorf("unknown filter \"%s\"", key)
+		}
+	}
+	return f, nil
+}
+
+func (f eventFilter) match(e event) bool {
+	return !e.Time.Before(f.since) &&
+		(f.source == "" || e.Source == f.source) &&
+		(f.action == "" || strings.HasPrefix(e.Action, f.action)) &&
+		(!f.failed || !e.OK)
+}
+
+// queryEvents returns the last events matching the filter, oldest
+// first. A limit of 0 returns all of them.
+func queryEvents(f eventFilter) ([]event, error) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+
+	events := []event{}
+	for _, file := range eventFiles() {
+		fp, err := os.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(fp)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var e event
+			if json.Unmarshal(scanner.Bytes(), &e) != nil || !f.match(e) {
+				continue
+			}
+			events = append(events, e)
+			if f.limit > 0 && len(events) > f.limit {
+				events = events[1:]
+			}
+		}
+		err = scanner.Err()
+		fp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+func actionEvents(args []string) (interface{}, error) {
+	f, err := parseEventFilter(args)
+	if err != nil {
+		return nil, err
+	}
+	return queryEvents(f)
+}
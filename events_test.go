@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseEventFilter(t *testing.T) {
+	since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		args []string
+		want eventFilter
+		ok   bool
+	}{
+		{nil, eventFilter{limit: defaultEventsLimit}, true},
+		{[]string{"since=2020-01-02T03:04:05Z", "source=cli", "action=proc.", "failed=true", "limit=0"},
+			eventFilter{since: since, source: "cli", action: "proc.", failed: true}, true},
+		{[]string{"limit=5", "limit=7"}, eventFilter{limit: 7}, true},
+		{[]string{"since"}, eventFilter{}, false},
+		{[]string{"since=yesterday"}, eventFilter{}, false},
+		{[]string{"failed=maybe"}, eventFilter{}, false},
+		{[]string{"limit=-1"}, eventFilter{}, false},
+		{[]string{"user=x"}, eventFilter{}, false},
+	}
+	for _, test := range tests {
+		got, err := parseEventFilter(test.args)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: error %v", test.args, err)
+		} else if test.ok && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %+v, want %+v", test.args, got, test.want)
+		}
+	}
+
+	f, err := parseEventFilter([]string{"since=1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(f.since); d < time.Hour || d > time.Hour+time.Minute {
+		t.Errorf("since=1h is %s ago", d)
+	}
+}
+
+// writeEvents writes the events as JSON lines to file.
+func writeEvents(t *testing.T, file string, events ...event) {
+	t.Helper()
+	var data []byte
+	for _, e := range events {
+		line, err := json.Marshal(&e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cenctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(dir string) { appDir = dir }(appDir)
+	appDir = dir
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+	file := filepath.Join(dir, eventsFilename)
+	writeEvents(t, file+".2",
+		event{Time: at(0), Source: sourceTray, Action: "proxy.on", OK: true},
+	)
+	writeEvents(t, file+".1",
+		event{Time: at(1), Source: sourceCLI, Action: "proc.start", Args: []string{"a"}, Error: "failed"},
+	)
+	writeEvents(t, file,
+		event{Time: at(2), Source: sourceCLI, Action: "proc.stop", Args: []string{"a"}, OK: true},
+		event{Time: at(3), Source: sourceAPI, Action: "v2ray.switch", Args: []string{"host1"}, OK: true},
+	)
+	if f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+		f.WriteString("not json\n")
+		f.Close()
+	}
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"proxy.on", "proc.start", "proc.stop", "v2ray.switch"}},
+		{[]string{"source=cli"}, []string{"proc.start", "proc.stop"}},
+		{[]string{"action=proc."}, []string{"proc.start", "proc.stop"}},
+		{[]string{"failed=true"}, []string{"proc.start"}},
+		{[]string{"since=2020-01-01T00:02:00Z"}, []string{"proc.stop", "v2ray.switch"}},
+		{[]string{"limit=3"}, []string{"proc.start", "proc.stop", "v2ray.switch"}},
+		{[]string{"source=cli", "limit=1"}, []string{"proc.stop"}},
+		{[]string{"source=health"}, nil},
+	}
+	for _, test := range tests {
+		f, err := parseEventFilter(test.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events, err := queryEvents(f)
+		if err != nil {
+			t.Fatalf("%q: %s", test.args, err)
+		}
+		var got []string
+		for _, e := range events {
+			got = append(got, e.Action)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestRecordEventRotation(t *testing.T) {
+	defer useTestAppDir(t)()
+	defer func(size int64, backups int) {
+		eventsMaxSize, eventsMaxBackups = size, backups
+	}(eventsMaxSize, eventsMaxBackups)
+	eventsMaxSize, eventsMaxBackups = 1, 2
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		recordEvent(event{Time: start.Add(time.Duration(i) * time.Minute), Source: sourceCLI, Action: fmt.Sprintf("a%d", i), OK: true})
+	}
+
+	file := filepath.Join(appDir, eventsFilename)
+	for _, name := range []string{file, file + ".1", file + ".2"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("generation missing: %s", err)
+		}
+	}
+	if _, err := os.Stat(file + ".3"); err == nil {
+		t.Errorf("%s kept past max_backups", file+".3")
+	}
+
+	events, err := queryEvents(eventFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Action)
+	}
+	if want := []string{"a2", "a3", "a4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
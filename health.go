@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var healthLog = componentLogger("health")
+
+const (
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 5 * time.Second
+	defaultHealthRetries  = 3
+
+	// A proc still unhealthy after a restart is restarted again after
+	// the backoff, doubled each time up to the maximum.
+	healthRestartBackoff    = time.Minute
+	maxHealthRestartBackoff = 30 * time.Minute
+)
+
+// healthCheck of a proc is one of a TCP address to connect, an HTTP URL
+// to get, or a command to run. The proc is unhealthy after Retries
+// failures in a row.
+type healthCheck struct {
+	TCP      string   `json:"tcp"`
+	HTTP     string   `json:"http"`
+	Status   int      `json:"status"`
+	Command  string   `json:"command"`
+	Args     []string `json:"args"`
+	Interval string   `json:"interval"`
+	Timeout  string   `json:"timeout"`
+	Retries  int      `json:"retries"`
+	Restart  bool     `json:"restart"`
+}
+
+const (
+	healthUnknown   = ""
+	healthHealthy   = "healthy"
+	healthUnhealthy = "unhealthy"
+)
+
+type healthState struct {
+	status   string
+	failures int
+	next     time.Time
+	checking bool
+	// restarts since the proc was last healthy, and when it may be
+	// restarted again.
+	restarts     int
+	restartAfter time.Time
+}
+
+func restartBackoff(restarts int) time.Duration {
+	d := healthRestartBackoff
+	for i := 1; i < restarts && d < maxHealthRestartBackoff; i++ {
+		d *= 2
+	}
+	if d > maxHealthRestartBackoff {
+		d = maxHealthRestartBackoff
+	}
+	return d
+}
+
+var (
+	healthMutex  sync.Mutex
+	healthStates = make(map[string]*healthState)
+)
+
+func procHealth(name string) string {
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	if s, ok := healthStates[name]; ok {
+		return s.status
+	}
+	return healthUnknown
+}
+
+func procTitle(name, health string) string {
+	if health == healthUnknown {
+		return "Proc: " + name
+	}
+	return fmt.Sprintf("Proc: %s (%s)", name, health)
+}
+
+func validateHealth(problems *configProblems, file, path string, h *healthCheck) {
+	if h == nil {
+		return
+	}
+
+	kinds := 0
+	for _, set := range []bool{h.TCP != "", h.HTTP != "", h.Command != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		problems.add(file, path, "need exactly one of tcp, http or command")
+	}
+	if h.TCP != "" {
+		checkHostPort(problems, file, path+".tcp", h.TCP)
+	}
+	if h.Status != 0 && (h.Status < 100 || h.Status > 599) {
+		problems.add(file, path+".status", "invalid HTTP status %d", h.Status)
+	}
+	checkDuration(problems, file, path+".interval", h.Interval)
+	checkDuration(problems, file, path+".timeout", h.Timeout)
+	if h.Retries < 0 {
+		problems.add(file, path+".retries", "must not be negative")
+	}
+}
+
+func (h *healthCheck) check() error {
+	timeout := parseDuration(h.Timeout, defaultHealthTimeout)
+
+	switch {
+	case h.TCP != "":
+		conn, err := net.DialTimeout("tcp", h.TCP, timeout)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	case h.HTTP != "":
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Get(h.HTTP)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		expect := h.Status
+		if expect == 0 && resp.StatusCode < 400 {
+			return nil
+		}
+		if expect != 0 && resp.StatusCode == expect {
+			return nil
+		}
+		return fmt.Errorf("HTTP status %d", resp.StatusCode)
+	case h.Command != "":
+		cmd := exec.Command(h.Command, h.Args...)
+		cmd.SysProcAttr = sysProcAttr()
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		done := make(chan error, 1)
+		go func() {
+			done <- cmd.Wait()
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(timeout):
+			cmd.Process.Kill()
+			return fmt.Errorf("timeout after %s", timeout)
+		}
+	}
+	return nil
+}
+
+func setProcHealth(p proc, status string) {
+	healthMutex.Lock()
+	s := healthStates[p.Name]
+	changed := s.status != status
+	s.status = status
+	healthMutex.Unlock()
+
+	if changed {
+		publishProcEvent(procEvent{Name: p.Name, State: procState(p.Name), Health: status, Time: time.Now()})
+	}
+}
+
+// checkProcHealth runs the due health check of p, and restarts it if it
+// became unhealthy and restart is set. A check still running, or a
+// restart, skips the next ones of p.
+func checkProcHealth(p proc) {
+	h := p.Health
+
+	healthMutex.Lock()
+	s, ok := healthStates[p.Name]
+	if !ok {
+		s = &healthState{}
+		healthStates[p.Name] = s
+	}
+	due := !s.checking && time.Now().After(s.next)
+	if due {
+		s.checking = true
+	}
+	healthMutex.Unlock()
+
+	if !due {
+		return
+	}
+	defer func() {
+		healthMutex.Lock()
+		s.checking = false
+		s.next = time.Now().Add(parseDuration(h.Interval, defaultHealthInterval))
+		healthMutex.Unlock()
+	}()
+	if !p.started() {
+		healthMutex.Lock()
+		s.failures = 0
+		healthMutex.Unlock()
+		setProcHealth(p, healthUnknown)
+		return
+	}
+
+	retries := h.Retries
+	if retries == 0 {
+		retries = defaultHealthRetries
+	}
+
+	err := h.check()
+	healthMutex.Lock()
+	if err == nil {
+		s.failures = 0
+		s.restarts = 0
+	} else {
+		s.failures++
+	}
+	failures := s.failures
+	healthMutex.Unlock()
+
+	switch {
+	case err == nil:
+		if procHealth(p.Name) != healthHealthy {
+			healthLog.Infof("Proc \"%s\" is healthy\n", p.Name)
+		}
+		setProcHealth(p, healthHealthy)
+	case failures >= retries:
+		if procHealth(p.Name) != healthUnhealthy {
+			healthLog.Warnf("Proc \"%s\" is unhealthy: %s\n", p.Name, err)
+			notify(notifyProcUnhealthy, "CenCtl: proc unhealthy", fmt.Sprintf("Proc \"%s\": %s", p.Name, err))
+		}
+		setProcHealth(p, healthUnhealthy)
+		if h.Restart {
+			restartUnhealthy(p, s)
+		}
+	default:
+		healthLog.Warnf("Proc \"%s\" health check failed (%d/%d): %s\n", p.Name, failures, retries, err)
+	}
+}
+
+// restartUnhealthy restarts p alone, unless it was restarted less than
+// the backoff ago.
+func restartUnhealthy(p proc, s *healthState) {
+	healthMutex.Lock()
+	wait := time.Until(s.restartAfter)
+	if wait <= 0 {
+		s.restarts++
+		s.restartAfter = time.Now().Add(restartBackoff(s.restarts))
+		s.failures = 0
+	}
+	restarts := s.restarts
+	healthMutex.Unlock()
+
+	if wait > 0 {
+		healthLog.Infof("Proc \"%s\" still unhealthy, restart it in %s\n", p.Name, wait.Round(time.Second))
+		return
+	}
+
+	healthLog.Warnf("Restart unhealthy proc \"%s\" (%d)\n", p.Name, restarts)
+	start := time.Now()
+	err := restartProc(p)
+	if err != nil {
+		healthLog.Errorf("Start proc error: %s\n", err)
+	}
+	recordAction(sourceHealth, "proc.restart", []string{p.Name}, start, err)
+}
+
+// monitorHealth checks the procs with a health check, each at its own
+// interval and in its own goroutine, so that a slow check or restart
+// does not delay the others. The procs are read from the config every
+// round, so that reloaded checks apply.
+func monitorHealth() {
+	for range time.Tick(time.Second) {
+		configMutex.RLock()
+		procs := append([]proc(nil), cfg.Proc...)
+		configMutex.RUnlock()
+
+		for _, p := range procs {
+			if p.Health != nil {
+				go checkProcHealth(p)
+			}
+		}
+	}
+}
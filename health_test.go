@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestSetProcHealthEvent(t *testing.T) {
+	const name = "cenctl-test-health"
+	setProcState(name, procRunning)
+	healthMutex.Lock()
+	healthStates[name] = &healthState{}
+	healthMutex.Unlock()
+
+	var events []procEvent
+	unsubscribe := subscribeProcState(func(e procEvent) {
+		if e.Name == name {
+			events = append(events, e)
+		}
+	})
+	defer unsubscribe()
+
+	p := proc{Name: name}
+	setProcHealth(p, healthUnhealthy)
+	setProcHealth(p, healthUnhealthy)
+	setProcState(name, procStopped)
+
+	if len(events) != 2 {
+		t.Fatalf("%d events, want 2: %+v", len(events), events)
+	}
+	if e := events[0]; e.Prev != "" || e.State != procRunning || e.Health != healthUnhealthy {
+		t.Errorf("health event %+v, want running and unhealthy without prev", e)
+	}
+	if e := events[1]; e.Prev != procRunning || e.State != procStopped || e.Health != healthUnhealthy {
+		t.Errorf("state event %+v, want stopped from running and unhealthy", e)
+	}
+}
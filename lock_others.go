@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+var lockLog = componentLogger("lock")
+
+var lockFiles []*os.File
+
+// acquireLock takes an exclusive flock on a file in the runtime dir. The
+// file is kept open until the process exits.
+func acquireLock(name string) bool {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, "cenctl-"+name+".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		lockLog.Errorf("Open lock file error: %s\n", err)
+		return true
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return false
+	}
+	lockFiles = append(lockFiles, f)
+	return true
+}
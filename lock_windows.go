@@ -0,0 +1,34 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var lockLog = componentLogger("lock")
+
+var createMutexProc, _ = syscall.GetProcAddress(kernel32, "CreateMutexW")
+
+// acquireLock creates the named mutex in the global namespace, so that it
+// is also seen across the service and the user session. The handle is
+// kept until the process exits.
+func acquireLock(name string) bool {
+	mutexName, err := syscall.UTF16PtrFromString(`Global\cenctl-` + name)
+	if err != nil {
+		lockLog.Errorf("Invalid lock name \"%s\": %s\n", name, err)
+		return true
+	}
+
+	h, _, callErr := syscall.Syscall(uintptr(createMutexProc), 3, 0, 0, uintptr(unsafe.Pointer(mutexName)))
+	switch callErr {
+	case syscall.ERROR_ALREADY_EXISTS, syscall.ERROR_ACCESS_DENIED:
+		if h != 0 {
+			syscall.CloseHandle(syscall.Handle(h))
+		}
+		return false
+	}
+	if h == 0 {
+		lockLog.Errorf("Create mutex \"%s\" error: %s\n", name, callErr)
+	}
+	return true
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLogMaxSize    = 10
+	defaultLogMaxBackups = 5
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l logLevel) String() string {
+	return levelNames[l]
+}
+
+func parseLogLevel(s string) (logLevel, bool) {
+	if s == "" {
+		return levelInfo, true
+	}
+	for i, name := range levelNames {
+		if name == s {
+			return logLevel(i), true
+		}
+	}
+	return levelInfo, false
+}
+
+// logConfig is the "log" section of config.json. MaxSize is in MB.
+type logConfig struct {
+	Level      string `json:"level"`
+	Format     string `json:"format"`
+	MaxSize    int    `json:"max_size"`
+	MaxAge     string `json:"max_age"`
+	MaxBackups int    `json:"max_backups"`
+}
+
+func validateLog(problems *configProblems, file string, c logConfig) {
+	if _, ok := parseLogLevel(c.Level); !ok {
+		problems.add(file, "log.level", "must be one of %s", strings.Join(levelNames, ", "))
+	}
+	if c.Format != "" && c.Format != "logfmt" && c.Format != "json" {
+		problems.add(file, "log.format", "must be logfmt or json")
+	}
+	if c.MaxSize < 0 {
+		problems.add(file, "log.max_size", "must not be negative")
+	}
+	if c.MaxBackups < 0 {
+		problems.add(file, "log.max_backups", "must not be negative")
+	}
+	checkDuration(problems, file, "log.max_age", c.MaxAge)
+}
+
+// logOutput is shared by all the loggers.
+type logOutput struct {
+	mu     sync.Mutex
+	w      io.Writer
+	level  logLevel
+	format string
+}
+
+// structLogger writes leveled records with key-value fields.
+type structLogger struct {
+	out    *logOutput
+	fields []interface{}
+}
+
+// logger writes to stderr until setupLogging opens the log file.
+var logger = &structLogger{out: &logOutput{w: os.Stderr, level: levelInfo, format: "logfmt"}}
+
+// with returns a logger adding the key-value pair to every record.
+func (l *structLogger) with(key string, value interface{}) *structLogger {
+	fields := append(append([]interface{}(nil), l.fields...), key, value)
+	return &structLogger{out: l.out, fields: fields}
+}
+
+func componentLogger(name string) *structLogger {
+	return logger.with("component", name)
+}
+
+func (l *structLogger) Debugf(format string, a ...interface{}) {
+	l.log(levelDebug, fmt.Sprintf(format, a...))
+}
+
+func (l *structLogger) Infof(format string, a ...interface{}) {
+	l.log(levelInfo, fmt.Sprintf(format, a...))
+}
+
+func (l *structLogger) Warnf(format string, a ...interface{}) {
+	l.log(levelWarn, fmt.Sprintf(format, a...))
+}
+
+func (l *structLogger) Errorf(format string, a ...interface{}) {
+	l.log(levelError, fmt.Sprintf(format, a...))
+}
+
+func (l *structLogger) log(level logLevel, msg string) {
+	o := l.out
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if level < o.level {
+		return
+	}
+
+	msg = strings.TrimRight(msg, "\n")
+	now := time.Now().Format(time.RFC3339)
+	var line string
+	if o.format == "json" {
+		record := map[string]interface{}{"time": now, "level": level.String(), "msg": msg}
+		for i := 0; i+1 < len(l.fields); i += 2 {
+			record[fmt.Sprint(l.fields[i])] = l.fields[i+1]
+		}
+		data, _ := json.Marshal(record)
+		line = string(data)
+	} else {
+		parts := []string{"time=" + now, "level=" + level.String()}
+		for i := 0; i+1 < len(l.fields); i += 2 {
+			parts = append(parts, fmt.Sprint(l.fields[i])+"="+logfmtValue(fmt.Sprint(l.fields[i+1])))
+		}
+		parts = append(parts, "msg="+logfmtValue(msg))
+		line = strings.Join(parts, " ")
+	}
+	io.WriteString(o.w, line+"\n")
+}
+
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\n\t") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// rotatingFile is a log file rotated to file.1, file.2, ... when it
+// exceeds maxSize or gets older than maxAge. Only the daemon owns and
+// rotates it. The CLI and the systray connected to the daemon open it
+// for each write, so that they never hold a file being rotated.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	owner      bool
+	f          *os.File
+	size       int64
+	opened     time.Time
+}
+
+func openRotatingFile(path string) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: defaultLogMaxSize << 20, maxBackups: defaultLogMaxBackups}
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size, r.opened = f, info.Size(), time.Now()
+	if t, ok := firstLogTime(r.path); ok && r.size > 0 {
+		r.opened = t
+	}
+	return nil
+}
+
+// firstLogTime returns the time of the first record of the log file,
+// when it was started. The modification time changes with every write.
+func firstLogTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(io.LimitReader(f, 64<<10)).ReadString('\n')
+
+	var record struct {
+		Time string `json:"time"`
+	}
+	if json.Unmarshal([]byte(line), &record) != nil && strings.HasPrefix(line, "time=") {
+		record.Time = strings.Fields(line)[0][len("time="):]
+	}
+	t, err := time.Parse(time.RFC3339, record.Time)
+	return t, err == nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if !r.owner {
+		return r.append(p)
+	}
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.size+int64(len(p)) > r.maxSize || (r.maxAge > 0 && time.Since(r.opened) > r.maxAge) {
+		if err := r.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Rotate log error: %s\n", err)
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// append writes p to the file opened only for it.
+func (r *rotatingFile) append(p []byte) (int, error) {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return f.Write(p)
+}
+
+// rotate renames the file to file.1 and opens a new one. The file that
+// could not be renamed is opened again, and rotated on the next write.
+func (r *rotatingFile) rotate() error {
+	if r.size == 0 {
+		return nil
+	}
+	r.f.Close()
+	r.f = nil
+
+	for i := r.maxBackups; i > 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i-1), fmt.Sprintf("%s.%d", r.path, i))
+	}
+	err := os.Rename(r.path, r.path+".1")
+	if openErr := r.open(); err == nil {
+		err = openErr
+	}
+	return err
+}
+
+var logFile *rotatingFile
+
+// setupLogging writes the log to the file instead of stderr.
+func setupLogging(path string) error {
+	f, err := openRotatingFile(path)
+	if err != nil {
+		return err
+	}
+	logger.out.mu.Lock()
+	logFile = f
+	logger.out.w = f
+	logger.out.mu.Unlock()
+	return nil
+}
+
+// ownLogFile makes this process, holding the daemon lock, the one
+// keeping the log file open and rotating it.
+func ownLogFile() {
+	o := logger.out
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if logFile == nil || logFile.owner {
+		return
+	}
+	if err := logFile.open(); err != nil {
+		fmt.Fprintf(os.Stderr, "Open log file error: %s\n", err)
+		return
+	}
+	logFile.owner = true
+}
+
+// configureLogging applies the log section of the config, also on
+// reload.
+func configureLogging(c logConfig) {
+	o := logger.out
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.level, _ = parseLogLevel(c.Level)
+	o.format = "logfmt"
+	if c.Format != "" {
+		o.format = c.Format
+	}
+	if logFile == nil {
+		return
+	}
+	logFile.maxSize = defaultLogMaxSize << 20
+	if c.MaxSize > 0 {
+		logFile.maxSize = int64(c.MaxSize) << 20
+	}
+	logFile.maxAge = parseDuration(c.MaxAge, 0)
+	logFile.maxBackups = defaultLogMaxBackups
+	if c.MaxBackups > 0 {
+		logFile.maxBackups = c.MaxBackups
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	defer useTestAppDir(t)()
+	path := filepath.Join(appDir, "cenctl.log")
+
+	for _, c := range []struct {
+		first  string
+		rotate bool
+	}{
+		{"time=" + time.Now().Add(-48*time.Hour).Format(time.RFC3339) + " level=info msg=old\n", true},
+		{`{"level":"info","msg":"old","time":"` + time.Now().Add(-48*time.Hour).Format(time.RFC3339) + `"}` + "\n", true},
+		{"time=" + time.Now().Add(-time.Hour).Format(time.RFC3339) + " level=info msg=new\n", false},
+	} {
+		os.Remove(path + ".1")
+		if err := ioutil.WriteFile(path, []byte(c.first), 0644); err != nil {
+			t.Fatal(err)
+		}
+		r := &rotatingFile{path: path, maxSize: 1 << 20, maxAge: 24 * time.Hour, maxBackups: 2, owner: true}
+		if err := r.open(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Write([]byte("time=now msg=next\n")); err != nil {
+			t.Fatal(err)
+		}
+		r.f.Close()
+
+		_, err := os.Stat(path + ".1")
+		if rotated := err == nil; rotated != c.rotate {
+			t.Errorf("log starting with %q rotated %v, want %v", c.first, rotated, c.rotate)
+		}
+	}
+}
+
+func TestRotatingFileRenameError(t *testing.T) {
+	defer useTestAppDir(t)()
+	path := filepath.Join(appDir, "cenctl.log")
+
+	// A directory in the way of cenctl.log.1 makes the rename fail.
+	if err := os.MkdirAll(filepath.Join(path+".1", "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	r := &rotatingFile{path: path, maxSize: 10, maxBackups: 1, owner: true}
+	if err := r.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { r.f.Close() }()
+	for _, line := range []string{"first line\n", "second line\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("write %q: %s", line, err)
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first line\nsecond line\n" {
+		t.Errorf("log %q, want both lines", data)
+	}
+}
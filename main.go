@@ -1,21 +1,21 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
+	"flag"
+	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path"
 	"path/filepath"
-	"reflect"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/sys/windows/registry"
 
 	"github.com/getlantern/systray"
 
@@ -23,288 +23,356 @@ import (
 )
 
 var (
-	wininet, _           = syscall.LoadLibrary("wininet.dll")
-	internetSetOption, _ = syscall.GetProcAddress(wininet, "InternetSetOptionW")
+	vmLog    = componentLogger("vm")
+	v2rayLog = componentLogger("v2ray")
 )
 
-var logger *log.Logger
-
 var configFilename = "config.json"
 
+// appDir is the directory of the executable, where config.json and
+// cenctl.log are.
+var appDir string
+
+const menuSpareSlots = 5
+
+var (
+	headless     = flag.Bool("headless", false, "Run without systray until SIGINT or SIGTERM")
+	runAsService = flag.Bool("service", false, "Run as a service, used by \"cenctl install\"")
+)
+
+// thinClient is set when the systray is started while another instance
+// (usually the service) is running, the menu then drives its control API.
+var thinClient bool
+
 type proc struct {
-	Name      string   `json:"name"`
-	Path      string   `json:"path"`
-	Args      []string `json:"args"`
-	AutoStart bool     `json:"auto_start"`
+	Name        string            `json:"name"`
+	Path        string            `json:"path"`
+	Args        []string          `json:"args"`
+	Env         map[string]string `json:"env"`
+	EnvFile     string            `json:"env_file"`
+	Cwd         string            `json:"cwd"`
+	AutoStart   bool              `json:"auto_start"`
+	DependsOn   []string          `json:"depends_on"`
+	Health      *healthCheck      `json:"health"`
+	StopTimeout string            `json:"stop_timeout"`
+}
+
+type vboxConfig struct {
+	VMName  string `json:"vm_name"`
+	SSHHost string `json:"ssh_host"`
+	HostKey string `json:"host_key"`
+	SSHKey  string `json:"ssh_key"`
+}
+
+type v2rayConfig struct {
+	Dir         string `json:"dir"`
+	ConfigFile  string `json:"config_file"`
+	StopTimeout string `json:"stop_timeout"`
+	Config      []struct {
+		Address string `json:"address"`
+		Port    int    `json:"port"`
+		ID      string `json:"id"`
+	} `json:"config"`
 }
 
 type config struct {
-	VBox struct {
-		VMName  string `json:"vm_name"`
-		SSHHost string `json:"ssh_host"`
-		HostKey string `json:"host_key"`
-		SSHKey  string `json:"ssh_key"`
-	} `json:"vbox"`
-	Proc  []proc `json:"proc"`
-	V2ray struct {
-		Dir        string `json:"dir"`
-		ConfigFile string `json:"config_file"`
-		Config     []struct {
-			Address string `json:"address"`
-			Port    int    `json:"port"`
-			ID      string `json:"id"`
-		} `json:"config"`
-	} `json:"v2ray"`
+	VBox  vboxConfig  `json:"vbox"`
+	Proc  []proc      `json:"proc"`
+	V2ray v2rayConfig `json:"v2ray"`
+	API   struct {
+		Addr      string `json:"addr"`
+		Dashboard bool   `json:"dashboard"`
+	} `json:"api"`
+	Menu     []menuConfig    `json:"menu"`
+	Startup  []startupStep   `json:"startup"`
+	Schedule []scheduleEntry `json:"schedule"`
+	Networks []networkConfig `json:"networks"`
+	Profiles []profileConfig `json:"profiles"`
+	// RestoreState is true by default, false starts from the config
+	// instead of the state saved on the last run.
+	RestoreState *bool           `json:"restore_state"`
+	Secrets      secretsConfig   `json:"secrets"`
+	Log          logConfig       `json:"log"`
+	Events       eventsConfig    `json:"events"`
+	Notify       map[string]bool `json:"notify"`
 }
 
 var cfg config
 
-var cfgV2ray map[string]interface{}
+var (
+	startIco []byte
+	stopIco  []byte
+)
+
+// cfgV2ray is the v2ray config. It is replaced and never changed in
+// place, so that a reader holding it needs no lock.
+var (
+	cfgV2rayMutex sync.Mutex
+	cfgV2ray      map[string]interface{}
+)
 
 func (p proc) started() bool {
-	cmd := exec.Command("tasklist", "/FI", "IMAGENAME eq "+p.Name)
-	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		logger.Printf("Get output for tasklist error: %s\n", err)
-	}
+	return processRunning(p.Name)
+}
 
-	err = cmd.Start()
+func (p proc) start() error {
+	cmd, err := p.command()
 	if err != nil {
-		logger.Printf("Run tasklist command error: %s\n", err)
+		return err
 	}
-
-	started := false
-
-	scanner := bufio.NewScanner(stdout)
-	for scanner.Scan() {
-		if strings.Contains(scanner.Text(), p.Name) {
-			started = true
-			break
-		}
+	if err := cmd.Start(); err != nil {
+		return err
 	}
-	if err := scanner.Err(); err != nil {
-		logger.Printf("Reading tasklist output error: %s\n", err)
-	}
-
-	err = cmd.Wait()
-	if err != nil {
-		logger.Printf("Command finished with error: %s\n", err)
-	}
-
-	return started
-}
 
-func (p proc) start() {
-	runCmd(p.Path, p.Args...)
+	go func() {
+		err := cmd.Wait()
+		procLog.Infof("Proc \"%s\" exited: %v\n", p.Name, err)
+		procExited(p.Name, err)
+	}()
+	return nil
 }
 
 func (p proc) stop() {
-	runCmdAndWait("taskkill", "/IM", p.Name, "/F")
+	stopProcess(p.Name, parseDuration(p.StopTimeout, defaultStopTimeout))
 }
 
 func onReady() {
-	logger.Println("Create systray")
+	logger.Infof("Create systray")
 
-	startIco, err := icon.Asset("start.ico")
+	var err error
+	startIco, err = icon.Asset("start.ico")
 	if err != nil {
-		logger.Printf("Can not access asset start.ico: %s", err)
+		logger.Errorf("Can not access asset start.ico: %s", err)
 	}
-	stopIco, err := icon.Asset("stop.ico")
+	stopIco, err = icon.Asset("stop.ico")
 	if err != nil {
-		logger.Printf("Can not access asset stop.ico: %s", err)
+		logger.Errorf("Can not access asset stop.ico: %s", err)
 	}
 
 	systray.SetIcon(startIco)
 	systray.SetTitle("CenCtl")
-	systray.SetTooltip("Center Control")
-
-	var cases []reflect.SelectCase
-
-	mIEProxy := systray.AddMenuItem("Enable IE Proxy", "Enable IE Proxy")
-	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(mIEProxy.ClickedCh)})
-
-	systray.AddSeparator()
-	v2rayItemStart := len(cases)
-
-	var mV2rayItems []*systray.MenuItem
-	curV2rayItem := currentV2rayConfig()
-	for _, v2rayItem := range cfg.V2ray.Config {
-		mV2rayItem := systray.AddMenuItem("V2ray: "+v2rayItem.Address, "V2ray: "+v2rayItem.Address)
-		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(mV2rayItem.ClickedCh)})
-		mV2rayItems = append(mV2rayItems, mV2rayItem)
-		if v2rayItem.Address == curV2rayItem {
-			mV2rayItem.Check()
+	systray.SetTooltip(trayTooltip())
+
+	m := newMenu(func(name string, args []string) {
+		trayAction(name, args...)
+	})
+
+	m.handle("v2ray.switch", func(args []string) {
+		go trayAction("v2ray.switch", args...)
+	})
+	m.handle("proc.start", func(args []string) {
+		go trayAction("proc.start", args...)
+	})
+	m.handle("proc.stop", func(args []string) {
+		go trayAction("proc.stop", args...)
+	})
+	m.handle("app.dashboard", func(args []string) {
+		openURL(dashboardURL())
+	})
+	m.handle("app.show-log", func(args []string) {
+		openURL(logPath())
+	})
+	m.handle("app.log-viewer", func(args []string) {
+		openURL(browserURL("/log"))
+	})
+	m.handle("app.diagnostics", func(args []string) {
+		go exportDiagnostics()
+	})
+	m.handle("pc.reboot", func(args []string) {
+		runTrayActionFrom(sourceExit, "vm.stop")
+		time.Sleep(10 * time.Second)
+		logger.Infof("Reboot the PC")
+		rebootPC()
+		systray.Quit()
+	})
+	m.handle("pc.shutdown", func(args []string) {
+		runTrayActionFrom(sourceExit, "vm.stop")
+		time.Sleep(10 * time.Second)
+		logger.Infof("Shutdown the PC")
+		shutdownPC()
+		systray.Quit()
+	})
+	m.handle("app.poweroff-exit", func(args []string) {
+		runTrayActionFrom(sourceExit, "vm.stop")
+		systray.Quit()
+	})
+	m.handle("app.exit", func(args []string) {
+		systray.Quit()
+	})
+
+	m.addSection("proxy", 0,
+		&menuItem{ID: "proxy", Title: "Enable IE Proxy", Action: "proxy.on", UncheckAction: "proxy.off", Checked: ieProxyEnabled()})
+	m.addSection("v2ray", menuSpareSlots, v2rayMenuItems()...)
+	m.addSection("proc", menuSpareSlots, procMenuItems()...)
+	if len(cfg.Profiles) > 0 {
+		m.addSection("profile", menuSpareSlots, profileMenuItems()...)
+	}
+	if len(cfg.Menu) > 0 {
+		m.addSection("custom", menuSpareSlots, customMenuItems(cfg.Menu, "custom:")...)
+		m.handle("custom", func(args []string) {
+			go runCustomItem(args)
+		})
+	}
+	m.addSection("status", menuSpareSlots, usageMenuItems(resourceUsage{})...)
+	var tools []*menuItem
+	if cfg.API.Dashboard {
+		tools = append(tools, &menuItem{ID: "app.dashboard", Title: "Open Dashboard", Tooltip: "Open the web dashboard", Action: "app.dashboard"})
+	}
+	m.addSection("tools", 0, append(tools,
+		&menuItem{ID: "app.show-log", Title: "Show Log", Tooltip: "Open cenctl.log", Action: "app.show-log"},
+		&menuItem{ID: "app.log-viewer", Title: "Recent Log", Tooltip: "Show the end of the log in the browser", Action: "app.log-viewer"},
+		&menuItem{ID: "app.diagnostics", Title: "Export Diagnostics", Tooltip: "Write a zip of the config, logs and state", Action: "app.diagnostics"})...)
+	m.addSection("pc", 0,
+		&menuItem{ID: "pc.reboot", Title: "Reboot PC", Tooltip: "Reboot the PC", Action: "pc.reboot"},
+		&menuItem{ID: "pc.shutdown", Title: "Shutdown PC", Tooltip: "Shutdown the PC", Action: "pc.shutdown"})
+	m.addSection("vm", 0,
+		&menuItem{ID: "vm.start", Title: "Start VM", Tooltip: "Start the VM", Action: "vm.start"},
+		&menuItem{ID: "vm.stop", Title: "Poweroff VM", Tooltip: "Poweroff the VM", Action: "vm.stop"})
+	m.addSection("poweroff-exit", 0,
+		&menuItem{ID: "app.poweroff-exit", Title: "Poweroff VM and Exit", Tooltip: "Poweroff the VM and exit", Action: "app.poweroff-exit"})
+	m.addSection("exit", 0,
+		&menuItem{ID: "app.exit", Title: "Exit", Tooltip: "Exit the whole app", Action: "app.exit"})
+
+	m.realize(systrayBackend{})
+	trayMenu = m
+	go updateUsageMenu()
+
+	if thinClient {
+		refreshMenu()
+		go followEvents(updateProcMenu, displayNotification)
+	} else {
+		subscribeProcState(updateProcMenu)
+		for _, p := range cfg.Proc {
+			trayMenu.setChecked("proc:"+p.Name, procActive(procState(p.Name)))
 		}
 	}
+}
 
-	systray.AddSeparator()
-	procItemStart := len(cases)
-
-	var mProcItems []*systray.MenuItem
-	for _, p := range cfg.Proc {
-		mProcItem := systray.AddMenuItem("Proc: "+p.Name, "Proc: "+p.Name)
-		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(mProcItem.ClickedCh)})
-		mProcItems = append(mProcItems, mProcItem)
-		if p.AutoStart || p.started() {
-			mProcItem.Check()
-		}
-	}
-
-	systray.AddSeparator()
-	poweroffItemStart := len(cases)
-
-	mRebootPC := systray.AddMenuItem("Reboot PC", "Reboot the PC")
-	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(mRebootPC.ClickedCh)})
-	mShutdownPC := systray.AddMenuItem("Shutdown PC", "Shutdown the PC")
-	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(mShutdownPC.ClickedCh)})
-
-	systray.AddSeparator()
-
-	mStartVM := systray.AddMenuItem("Start VM", "Start the VM")
-	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(mStartVM.ClickedCh)})
-	mPoweroffVM := systray.AddMenuItem("Poweroff VM", "Poweroff the VM")
-	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(mPoweroffVM.ClickedCh)})
-
-	systray.AddSeparator()
-
-	mPoweroffVMAndExit := systray.AddMenuItem("Poweroff VM and Exit", "Poweroff the VM and exit")
-	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(mPoweroffVMAndExit.ClickedCh)})
-
-	systray.AddSeparator()
+// updateProcMenu checks the menu item of the proc of e, and shows its
+// health in the title.
+func updateProcMenu(e procEvent) {
+	trayMenu.setChecked("proc:"+e.Name, procActive(e.State))
+	trayMenu.setTitle("proc:"+e.Name, procTitle(e.Name, e.Health))
+}
 
-	mExit := systray.AddMenuItem("Exit", "Exit the whole app")
-	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(mExit.ClickedCh)})
+func v2rayMenuItems() []*menuItem {
+	current := currentV2rayConfig()
+	var items []*menuItem
+	for _, v2rayItem := range cfg.V2ray.Config {
+		items = append(items, &menuItem{
+			ID:      "v2ray:" + v2rayItem.Address,
+			Title:   "V2ray: " + v2rayItem.Address,
+			Action:  "v2ray.switch",
+			Args:    []string{v2rayItem.Address},
+			Checked: v2rayItem.Address == current,
+		})
+	}
+	return items
+}
 
-	go func() {
-		for {
-			chosen, _, _ := reflect.Select(cases)
-
-			switch {
-			case chosen == 0:
-				if mIEProxy.Checked() {
-					disableIEProxy()
-					logger.Println("IE proxy disabled")
-					mIEProxy.Uncheck()
-				} else {
-					enableIEProxy()
-					logger.Println("IE proxy enabled")
-					mIEProxy.Check()
-				}
-			case chosen >= v2rayItemStart && chosen < procItemStart:
-				for i, v2rayItem := range cfg.V2ray.Config {
-					mV2rayItem := mV2rayItems[i]
-					if i+v2rayItemStart == chosen {
-						if !mV2rayItem.Checked() {
-							logger.Printf("Switch v2ray to \"%s\"\n", v2rayItem.Address)
-							switchV2ray(v2rayItem.Address, v2rayItem.Port, v2rayItem.ID)
-							mV2rayItem.Check()
-						}
-					} else {
-						if mV2rayItem.Checked() {
-							mV2rayItem.Uncheck()
-						}
-					}
-				}
-			case chosen >= procItemStart && chosen < poweroffItemStart:
-				p := cfg.Proc[chosen-procItemStart]
-				mProcItem := mProcItems[chosen-procItemStart]
-				if mProcItem.Checked() {
-					logger.Printf("Stop proc \"%s\"\n", p.Name)
-					p.stop()
-					mProcItem.Uncheck()
-				} else {
-					logger.Printf("Start proc \"%s\"\n", p.Name)
-					p.start()
-					mProcItem.Check()
-				}
-			case chosen == poweroffItemStart:
-				logger.Println("Poweroff VM")
-				poweroffVM()
-				time.Sleep(10 * time.Second)
-				logger.Println("Reboot the PC")
-				runCmd("cmd", "/C", "shutdown", "/t", "0", "/r")
-				systray.Quit()
-				return
-			case chosen == poweroffItemStart+1:
-				logger.Println("Poweroff VM")
-				poweroffVM()
-				time.Sleep(10 * time.Second)
-				logger.Println("Shutdown the PC")
-				runCmd("cmd", "/C", "shutdown", "/t", "0", "/s")
-				systray.Quit()
-				return
-			case chosen == poweroffItemStart+2:
-				systray.SetIcon(startIco)
-				logger.Println("Start VM")
-				startVM()
-			case chosen == poweroffItemStart+3:
-				systray.SetIcon(stopIco)
-				logger.Println("Poweroff VM")
-				poweroffVM()
-			case chosen == poweroffItemStart+4:
-				logger.Println("Poweroff VM")
-				poweroffVM()
-				systray.Quit()
-				return
-			case chosen == poweroffItemStart+5:
-				systray.Quit()
-				return
-			}
-		}
-	}()
+// procMenuItems checks the procs that are running or being started.
+func procMenuItems() []*menuItem {
+	var items []*menuItem
+	for _, p := range cfg.Proc {
+		items = append(items, &menuItem{
+			ID:            "proc:" + p.Name,
+			Title:         procTitle(p.Name, procHealth(p.Name)),
+			Action:        "proc.start",
+			UncheckAction: "proc.stop",
+			Args:          []string{p.Name},
+			Checked:       procActive(procState(p.Name)),
+		})
+	}
+	return items
 }
 
 func onExit() {
-	logger.Println("Quit systray")
+	logger.Infof("Quit systray")
 }
 
 func runCmd(name string, arg ...string) {
 	cmd := exec.Command(name, arg...)
-	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	cmd.SysProcAttr = sysProcAttr()
 	err := cmd.Start()
 	if err != nil {
-		logger.Printf("Run command error: %s", err)
+		logger.Errorf("Run command error: %s", err)
 	}
 }
 
+func runCmdOutput(name string, arg ...string) (string, error) {
+	cmd := exec.Command(name, arg...)
+	cmd.SysProcAttr = sysProcAttr()
+	out, err := cmd.Output()
+	return string(out), err
+}
+
 func runCmdAndWait(name string, arg ...string) {
 	cmd := exec.Command(name, arg...)
-	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	cmd.SysProcAttr = sysProcAttr()
 	err := cmd.Start()
 	if err != nil {
-		logger.Printf("Run command error: %s\n", err)
+		logger.Errorf("Run command error: %s\n", err)
 	}
 	err = cmd.Wait()
 	if err != nil {
-		logger.Printf("Command finished with error: %s\n", err)
+		logger.Errorf("Command finished with error: %s\n", err)
 	}
 }
 
-func startVM() {
-	runCmd("C:\\Program Files\\Oracle\\VirtualBox\\VBoxManage.exe", "startvm", cfg.VBox.VMName, "--type", "headless")
+func startVM(vbox vboxConfig) {
+	runCmd(vboxManage, "startvm", vbox.VMName, "--type", "headless")
 }
 
 func acpiPoweroffVM() {
-	runCmd("C:\\Program Files\\Oracle\\VirtualBox\\VBoxManage.exe", "controlvm", cfg.VBox.VMName, "acpipowerbutton")
+	runCmd(vboxManage, "controlvm", cfg.VBox.VMName, "acpipowerbutton")
+}
+
+func vmState() string {
+	out, err := runCmdOutput(vboxManage, "showvminfo", cfg.VBox.VMName, "--machinereadable")
+	if err != nil {
+		vmLog.Errorf("Get VM info error: %s\n", err)
+		return "unknown"
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "VMState=") {
+			return strings.Trim(strings.TrimPrefix(line, "VMState="), "\"")
+		}
+	}
+	return "unknown"
 }
 
-func sshPoweroffVM() {
-	key, err := ioutil.ReadFile(cfg.VBox.SSHKey)
+// sshPrivateKey reads the key file of ssh_key. Its secret may hold the
+// key itself instead of the path.
+func sshPrivateKey(vbox vboxConfig) ([]byte, error) {
+	sshKey, err := resolveSecret(vbox.SSHKey)
 	if err != nil {
-		logger.Printf("Unable to read private key: %s", err)
-		return
+		return nil, err
+	}
+	if isSecretRef(vbox.SSHKey) && strings.Contains(sshKey, "PRIVATE KEY") {
+		return []byte(sshKey), nil
+	}
+	return ioutil.ReadFile(sshKey)
+}
+
+func sshRun(vbox vboxConfig, command string) ([]byte, error) {
+	key, err := sshPrivateKey(vbox)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read private key: %s", err)
 	}
 	signer, err := ssh.ParsePrivateKey(key)
 	if err != nil {
-		log.Printf("Unable to parse private key: %s", err)
-		return
+		return nil, fmt.Errorf("unable to parse private key: %s", err)
 	}
 
-	_, _, hostKey, _, _, err := ssh.ParseKnownHosts([]byte(cfg.VBox.HostKey))
+	knownHost, err := resolveSecret(vbox.HostKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host key: %s", err)
+	}
+	_, _, hostKey, _, _, err := ssh.ParseKnownHosts([]byte(knownHost))
 	if err != nil {
-		log.Printf("Failed to get host key: %s", err)
-		return
+		return nil, fmt.Errorf("failed to get host key: %s", err)
 	}
 
 	config := &ssh.ClientConfig{
@@ -314,191 +382,322 @@ func sshPoweroffVM() {
 		},
 		HostKeyCallback: ssh.FixedHostKey(hostKey),
 	}
-	client, err := ssh.Dial("tcp", cfg.VBox.SSHHost, config)
+	client, err := ssh.Dial("tcp", vbox.SSHHost, config)
 	if err != nil {
-		log.Printf("Failed to dial: %s", err)
-		return
+		return nil, fmt.Errorf("failed to dial: %s", err)
 	}
+	defer client.Close()
 
 	session, err := client.NewSession()
 	if err != nil {
-		log.Printf("Failed to create session: %s", err)
-		return
+		return nil, fmt.Errorf("failed to create session: %s", err)
 	}
 	defer session.Close()
 
-	if err := session.Run("/usr/bin/poweroff"); err != nil {
-		log.Printf("Failed to poweroff: %s", err)
-		return
+	return session.CombinedOutput(command)
+}
+
+func sshPoweroffVM(vbox vboxConfig) {
+	if _, err := sshRun(vbox, "/usr/bin/poweroff"); err != nil {
+		vmLog.Errorf("SSH poweroff error: %s\n", err)
+		notify(notifyVMError, "CenCtl: VM poweroff failed", err.Error())
 	}
 }
 
-func poweroffVM() {
-	sshPoweroffVM()
+// poweroffVM stops the procs of c depending on the VM, then powers it
+// off.
+func poweroffVM(c config) {
+	stopDependents("vm", c.Proc)
+	sshPoweroffVM(c.VBox)
 }
 
-func updateIEOption() {
-	ret, _, callErr := syscall.Syscall6(uintptr(internetSetOption),
-		4,
-		0,
-		95,
-		0,
-		0,
-		0,
-		0)
-	if callErr != 0 {
-		log.Print("Call InternetSetOption", callErr)
-	}
-	if ret == 0 {
-		log.Print("Run InternetSetOption error")
-	}
-	return
+func startV2ray(v2ray v2rayConfig) {
+	runCmd(path.Join(v2ray.Dir, v2rayExe), "-config", path.Join(v2ray.Dir, v2ray.ConfigFile))
 }
 
-func enableIEProxy() {
-	key, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Internet Settings`, registry.ALL_ACCESS)
-	if err != nil {
-		log.Print(err)
-		return
-	}
-	defer key.Close()
+func stopV2ray(v2ray v2rayConfig) {
+	stopProcess(v2rayExe, parseDuration(v2ray.StopTimeout, defaultStopTimeout))
+}
 
-	key.SetStringValue("ProxyOverride", "<local>;localhost;127.*;10.*;172.16.*;172.17.*;172.18.*;172.19.*;172.20.*;172.21.*;172.22.*;172.23.*;172.24.*;172.25.*;172.26.*;172.27.*;172.28.*;172.29.*;172.30.*;172.31.*;192.168.*")
-	key.SetStringValue("ProxyServer", "127.0.0.1:3128")
-	key.SetDWordValue("ProxyEnable", 1)
+// switchV2ray restarts v2ray with the server. If the config can not be
+// saved, v2ray is started again with the previous server.
+func switchV2ray(v2ray v2rayConfig, address string, port int, id string) error {
+	stopV2ray(v2ray)
 
-	updateIEOption()
-}
+	c := copyJSON(currentV2ray()).(map[string]interface{})
+	cfgVnext := v2rayVnext(c)
+	cfgVnext["address"] = address
+	cfgVnext["port"] = port
+	cfgVnext["users"].([]interface{})[0].(map[string]interface{})["id"] = id
 
-func disableIEProxy() {
-	key, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Internet Settings`, registry.ALL_ACCESS)
-	if err != nil {
-		log.Print(err)
-		return
+	err := saveV2rayConfig(v2ray, c)
+	if err == nil {
+		setV2rayConfig(c)
 	}
-	defer key.Close()
 
-	key.SetDWordValue("ProxyEnable", 0)
-
-	updateIEOption()
+	time.Sleep(time.Second)
+	startV2ray(v2ray)
+	return err
 }
 
-func startV2ray() {
-	runCmd(path.Join(cfg.V2ray.Dir, "wv2ray.exe"), "-config", path.Join(cfg.V2ray.Dir, cfg.V2ray.ConfigFile))
-}
+func readV2rayConfig(file string) (map[string]interface{}, configProblems) {
+	buffer, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, configProblems{{File: file, Message: err.Error()}}
+	}
 
-func stopV2ray() {
-	runCmdAndWait("taskkill", "/IM", "wv2ray.exe", "/F")
+	var c map[string]interface{}
+	if problems := parseJSON(file, buffer, &c); len(problems) > 0 {
+		return nil, problems
+	}
+	return c, validateV2rayConfig(file, c)
 }
 
-func switchV2ray(address string, port int, id string) {
-	go func() {
-		stopV2ray()
-
-		cfgVnext := cfgV2ray["outbounds"].([]interface{})[0].(map[string]interface{})["settings"].(map[string]interface{})["vnext"].([]interface{})[0].(map[string]interface{})
-		cfgVnext["address"] = address
-		cfgVnext["port"] = port
-		cfgVnext["users"].([]interface{})[0].(map[string]interface{})["id"] = id
+func loadV2rayConfig() error {
+	c, problems := readV2rayConfig(path.Join(cfg.V2ray.Dir, cfg.V2ray.ConfigFile))
+	if len(problems) > 0 {
+		return problems
+	}
 
-		saveV2rayConfig()
+	setV2rayConfig(c)
+	return nil
+}
 
-		time.Sleep(time.Second)
-		startV2ray()
-	}()
+func currentV2ray() map[string]interface{} {
+	cfgV2rayMutex.Lock()
+	defer cfgV2rayMutex.Unlock()
+	return cfgV2ray
 }
 
-func loadV2rayConfig() {
-	buffer, err := ioutil.ReadFile(path.Join(cfg.V2ray.Dir, cfg.V2ray.ConfigFile))
-	if err != nil {
-		logger.Panicf("V2ray config file \"%s\" read error: %s\n", cfg.V2ray.ConfigFile, err)
-	}
+func setV2rayConfig(c map[string]interface{}) {
+	cfgV2rayMutex.Lock()
+	cfgV2ray = c
+	cfgV2rayMutex.Unlock()
+}
 
-	err = json.Unmarshal(buffer, &cfgV2ray)
-	if err != nil {
-		logger.Panicf("Parse v2ray config error: %s\n", err)
+// copyJSON returns a deep copy of a value decoded from JSON.
+func copyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			c[key] = copyJSON(value)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, value := range v {
+			c[i] = copyJSON(value)
+		}
+		return c
 	}
+	return v
 }
 
-func saveV2rayConfig() {
-	data, err := json.MarshalIndent(&cfgV2ray, "", "  ")
+func saveV2rayConfig(v2ray v2rayConfig, c map[string]interface{}) error {
+	data, err := json.MarshalIndent(&c, "", "  ")
 	if err != nil {
-		logger.Printf("Save v2ray config error: %s\n", err)
+		v2rayLog.Errorf("Save v2ray config error: %s\n", err)
+		return err
 	}
 
-	err = ioutil.WriteFile(path.Join(cfg.V2ray.Dir, cfg.V2ray.ConfigFile), data, 0644)
+	file := path.Join(v2ray.Dir, v2ray.ConfigFile)
+	tmp := file + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err == nil {
+		err = os.Rename(tmp, file)
+	}
 	if err != nil {
-		logger.Panicf("V2ray config file \"%s\" write error: %s\n", cfg.V2ray.ConfigFile, err)
+		os.Remove(tmp)
+		v2rayLog.Errorf("V2ray config file \"%s\" write error: %s\n", v2ray.ConfigFile, err)
+		notify(notifyV2rayError, "CenCtl: v2ray config not saved", err.Error())
+		return fmt.Errorf("save v2ray config: %s", err)
 	}
+	return nil
+}
+
+// v2rayVnext returns the server of the v2ray config c.
+func v2rayVnext(c map[string]interface{}) map[string]interface{} {
+	return c["outbounds"].([]interface{})[0].(map[string]interface{})["settings"].(map[string]interface{})["vnext"].([]interface{})[0].(map[string]interface{})
 }
 
 func currentV2rayConfig() string {
-	return cfgV2ray["outbounds"].([]interface{})[0].(map[string]interface{})["settings"].(map[string]interface{})["vnext"].([]interface{})[0].(map[string]interface{})["address"].(string)
+	return v2rayVnext(currentV2ray())["address"].(string)
 }
 
-func loadConfig(dir string) {
-	buffer, err := ioutil.ReadFile(path.Join(dir, configFilename))
-	if err != nil {
-		logger.Panicf("Config file \"%s\" read error: %s\n", configFilename, err)
+func currentV2rayServer() (string, int, string) {
+	cfgVnext := v2rayVnext(currentV2ray())
+	address, _ := cfgVnext["address"].(string)
+	id, _ := cfgVnext["users"].([]interface{})[0].(map[string]interface{})["id"].(string)
+
+	var port int
+	switch p := cfgVnext["port"].(type) {
+	case float64:
+		port = int(p)
+	case int:
+		port = p
 	}
+	return address, port, id
+}
+
+func readConfig(file string) (config, configProblems) {
+	var c config
 
-	err = json.Unmarshal(buffer, &cfg)
+	buffer, err := ioutil.ReadFile(file)
 	if err != nil {
-		logger.Panicf("Parse config error: %s\n", err)
+		return c, configProblems{{File: file, Message: err.Error()}}
 	}
-}
 
-func autoStart() {
-	for _, p := range cfg.Proc {
-		if !p.AutoStart {
-			continue
-		}
-		if p.started() {
-			logger.Printf("Command already started: %s\n", p.Name)
-			continue
-		}
-		logger.Printf("Auto start command: %s\n", p.Name)
-		p.start()
+	if problems := parseJSON(file, buffer, &c); len(problems) > 0 {
+		return c, problems
 	}
+	return c, c.validate(file)
 }
 
-func main() {
-	dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
-	if err != nil {
-		log.Fatal(err)
+func loadConfig(dir string) error {
+	c, problems := readConfig(path.Join(dir, configFilename))
+	if len(problems) > 0 {
+		return problems
 	}
 
-	f, err := os.OpenFile(path.Join(dir, "cenctl.log"),
-		os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Println(err)
-	}
-	defer f.Close()
+	cfg = c
+	setSecretsConfig(c.Secrets)
+	setNotifyConfig(c.Notify)
+	configureLogging(cfg.Log)
+	configureEvents(cfg.Events)
+	return nil
+}
 
-	logger = log.New(f, "[CenCtl] ", log.LstdFlags)
+// checkConfig reports the problems of config.json and, if it could be
+// parsed, of the v2ray config file it refers to.
+func checkConfig(dir string) configProblems {
+	c, problems := readConfig(path.Join(dir, configFilename))
+	if c.V2ray.Dir == "" || c.V2ray.ConfigFile == "" {
+		return problems
+	}
 
-	logger.Println("================================================================================")
-	logger.Println("Start application")
+	_, v2rayProblems := readV2rayConfig(path.Join(c.V2ray.Dir, c.V2ray.ConfigFile))
+	return append(problems, v2rayProblems...)
+}
 
-	loadConfig(dir)
+func startDaemon() {
+	ownLogFile()
+	serveAPI()
 
-	loadV2rayConfig()
+	go watchConfig(appDir)
 
+	subscribeProcState(notifyProcEvent)
+	subscribeProcState(recordProcEvent)
+	restoreProfile()
+	go pollProcStates()
 	go func() {
-		autoStart()
+		// The settings of the network apply after the startup plan,
+		// or the restore, so that they do not race.
+		runStartup(startupPlan())
+		watchNetwork()
 	}()
+	go monitorHealth()
+	go monitorUsage()
+	go runSchedule()
+}
 
-	go func() {
-		time.Sleep(30 * time.Second)
-		logger.Println("After waiting for 10 seconds")
+func runHeadless() {
+	logger.Infof("Run in headless mode")
+	done := make(chan struct{})
+	handleSignals(func() { close(done) })
+	<-done
+}
 
-		logger.Println("Start VM")
-		startVM()
+func handleSignals(quit func()) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigCh
+		logger.Infof("Received signal \"%s\"\n", sig)
+		if !thinClient {
+			logger.Infof("Poweroff VM")
+			poweroffVM(configSnapshot())
+		}
+		quit()
 	}()
+}
+
+func main() {
+	flag.Usage = func() {
+		attachConsole()
+		fmt.Fprint(os.Stderr, cliUsage)
+		flag.PrintDefaults()
+	}
+	args := parseArgs(flag.CommandLine, os.Args[1:])
+
+	dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
+	if err != nil {
+		logger.Errorf("Get executable directory error: %s\n", err)
+		os.Exit(1)
+	}
+	appDir = dir
+
+	if err := setupLogging(logPath()); err != nil {
+		logger.Errorf("Open log file error: %s\n", err)
+	}
+
+	if len(args) > 0 && args[0] == "config" {
+		os.Exit(runConfigCLI(dir, args[1:]))
+	}
+
+	err = loadConfig(dir)
+	if err == nil {
+		err = loadV2rayConfig()
+	}
+	if err != nil {
+		logger.Errorf("Load config error:\n%s\n", err)
+		if len(args) > 0 || *headless || *runAsService {
+			attachConsole()
+			fmt.Fprintf(os.Stderr, "Load config error:\n%s\n", err)
+		} else {
+			showError("CenCtl config error", err.Error())
+		}
+		os.Exit(1)
+	}
 
-	disableIEProxy()
+	if len(args) > 0 {
+		os.Exit(runCLI(args))
+	}
 
-	systray.Run(onReady, onExit)
+	logger.Infof("Start application")
+
+	switch {
+	case *runAsService:
+		if !acquireLock("daemon") {
+			logger.Warnf("Another instance is already running")
+			os.Exit(1)
+		}
+		runService()
+	case *headless:
+		if !acquireLock("daemon") {
+			logger.Warnf("Another instance is already running")
+			os.Exit(1)
+		}
+		restoreProxy()
+		startDaemon()
+		runHeadless()
+	default:
+		if !acquireLock("tray") {
+			logger.Infof("Systray already running, show its status")
+			os.Exit(runCLI([]string{"status"}))
+		}
+		restoreProxy()
+		if acquireLock("daemon") {
+			startDaemon()
+		} else {
+			thinClient = true
+			logger.Infof("Connect to the running instance at %s\n", apiAddr())
+			go watchConfig(appDir)
+			go watchNetwork()
+		}
+		handleSignals(systray.Quit)
+		systray.Run(onReady, onExit)
+	}
 
-	logger.Println("Exit application")
-	logger.Println("--------------------------------------------------------------------------------")
+	logger.Infof("Exit application")
 }
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/getlantern/systray"
+)
+
+var menuLog = componentLogger("menu")
+
+// menuItem is a node of the menu model. Clicking it runs Action, or
+// UncheckAction when it is checked. An item with children is a submenu.
+type menuItem struct {
+	ID            string
+	Separator     bool
+	Title         string
+	Tooltip       string
+	Action        string
+	UncheckAction string
+	Args          []string
+	Checked       bool
+	Children      []*menuItem
+}
+
+// menuBackendItem is the part of systray.MenuItem used by the menu.
+type menuBackendItem interface {
+	SetTitle(title string)
+	SetTooltip(tooltip string)
+	Check()
+	Uncheck()
+	Enable()
+	Disable()
+	Show()
+	Hide()
+}
+
+// menuBackend creates the native items, so that the menu can be driven
+// without a real systray.
+type menuBackend interface {
+	AddItem() (menuBackendItem, <-chan struct{})
+	AddSeparator()
+}
+
+type systrayBackend struct{}
+
+func (systrayBackend) AddItem() (menuBackendItem, <-chan struct{}) {
+	item := systray.AddMenuItem("", "")
+	return item, item.ClickedCh
+}
+
+func (systrayBackend) AddSeparator() {
+	systray.AddSeparator()
+}
+
+type menuSlot struct {
+	item menuBackendItem
+	row  *menuItem
+}
+
+// menuSection is a group of items between separators. Native items can
+// not be inserted or removed once created, so a section keeps spare
+// hidden slots for items added at runtime.
+type menuSection struct {
+	name  string
+	spare int
+	items []*menuItem
+	slots []*menuSlot
+}
+
+type menuRow struct {
+	item  *menuItem
+	title string
+}
+
+type menu struct {
+	mu       sync.Mutex
+	sections []*menuSection
+	handlers map[string]func(args []string)
+	fallback func(name string, args []string)
+	clicks   chan *menuSlot
+}
+
+var trayMenu *menu
+
+func newMenu(fallback func(name string, args []string)) *menu {
+	return &menu{
+		handlers: make(map[string]func(args []string)),
+		fallback: fallback,
+		clicks:   make(chan *menuSlot),
+	}
+}
+
+// handle binds an action name to a handler for this menu only. Other
+// actions go to the fallback.
+func (m *menu) handle(name string, h func(args []string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[name] = h
+}
+
+func (m *menu) addSection(name string, spare int, items ...*menuItem) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sections = append(m.sections, &menuSection{name: name, spare: spare, items: items})
+}
+
+func (m *menu) section(name string) *menuSection {
+	for _, s := range m.sections {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// realize creates the native items and starts dispatching clicks. It
+// must be called once, after the sections are added.
+func (m *menu) realize(backend menuBackend) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, s := range m.sections {
+		if i > 0 {
+			backend.AddSeparator()
+		}
+		n := len(flattenMenu(s.items, 0)) + s.spare
+		for j := 0; j < n; j++ {
+			item, clicked := backend.AddItem()
+			slot := &menuSlot{item: item}
+			s.slots = append(s.slots, slot)
+			go func() {
+				for range clicked {
+					m.clicks <- slot
+				}
+			}()
+		}
+		m.render(s)
+	}
+
+	go m.dispatch()
+}
+
+func flattenMenu(items []*menuItem, depth int) []menuRow {
+	var rows []menuRow
+	for _, item := range items {
+		rows = append(rows, menuRow{item: item, title: strings.Repeat("    ", depth) + item.Title})
+		rows = append(rows, flattenMenu(item.Children, depth+1)...)
+	}
+	return rows
+}
+
+// render shows the items of the section in its slots. Submenus are
+// shown inline with indented children, since the systray has no native
+// submenus.
+func (m *menu) render(s *menuSection) {
+	rows := flattenMenu(s.items, 0)
+	if len(rows) > len(s.slots) {
+		menuLog.Warnf("Not enough menu slots in section \"%s\" for %d items, restart to show all\n", s.name, len(rows))
+	}
+
+	for i, slot := range s.slots {
+		if i >= len(rows) {
+			slot.row = nil
+			slot.item.Hide()
+			continue
+		}
+
+		row := rows[i]
+		slot.row = row.item
+		if row.item.Separator {
+			slot.item.SetTitle(strings.Repeat("\u2500", 12))
+			slot.item.SetTooltip("")
+			slot.item.Uncheck()
+			slot.item.Disable()
+			slot.item.Show()
+			continue
+		}
+		slot.item.SetTitle(row.title)
+		tooltip := row.item.Tooltip
+		if tooltip == "" {
+			tooltip = row.item.Title
+		}
+		slot.item.SetTooltip(tooltip)
+		if row.item.Checked {
+			slot.item.Check()
+		} else {
+			slot.item.Uncheck()
+		}
+		if row.item.Action == "" && row.item.UncheckAction == "" {
+			slot.item.Disable()
+		} else {
+			slot.item.Enable()
+		}
+		slot.item.Show()
+	}
+}
+
+// setItems replaces the items of a section at runtime.
+func (m *menu) setItems(section string, items []*menuItem) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.section(section)
+	if s == nil {
+		if len(items) > 0 {
+			menuLog.Warnf("Menu section \"%s\" not created, restart to show it\n", section)
+		}
+		return
+	}
+	s.items = items
+	if s.slots != nil {
+		m.render(s)
+	}
+}
+
+func (m *menu) add(section string, item *menuItem) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.section(section)
+	if s == nil {
+		return
+	}
+	s.items = append(s.items, item)
+	if s.slots != nil {
+		m.render(s)
+	}
+}
+
+func (m *menu) remove(id string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sections {
+		if items, ok := removeMenuItem(s.items, id); ok {
+			s.items = items
+			if s.slots != nil {
+				m.render(s)
+			}
+			return
+		}
+	}
+}
+
+func removeMenuItem(items []*menuItem, id string) ([]*menuItem, bool) {
+	for i, item := range items {
+		if item.ID == id {
+			return append(items[:i:i], items[i+1:]...), true
+		}
+		if children, ok := removeMenuItem(item.Children, id); ok {
+			item.Children = children
+			return items, true
+		}
+	}
+	return items, false
+}
+
+func findMenuItem(items []*menuItem, id string) *menuItem {
+	for _, item := range items {
+		if item.ID == id {
+			return item
+		}
+		if found := findMenuItem(item.Children, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func (m *menu) setChecked(id string, checked bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sections {
+		item := findMenuItem(s.items, id)
+		if item == nil {
+			continue
+		}
+		item.Checked = checked
+		for _, slot := range s.slots {
+			if slot.row != item {
+				continue
+			}
+			if checked {
+				slot.item.Check()
+			} else {
+				slot.item.Uncheck()
+			}
+		}
+		return
+	}
+}
+
+func (m *menu) setTitle(id, title string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sections {
+		if item := findMenuItem(s.items, id); item != nil {
+			item.Title = title
+			m.render(s)
+			return
+		}
+	}
+}
+
+func (m *menu) dispatch() {
+	for slot := range m.clicks {
+		m.mu.Lock()
+		item := slot.row
+		var name string
+		var args []string
+		if item != nil {
+			name, args = item.Action, item.Args
+			if item.Checked {
+				name = item.UncheckAction
+			}
+		}
+		h := m.handlers[name]
+		m.mu.Unlock()
+
+		if name == "" {
+			continue
+		}
+		if h != nil {
+			h(args)
+		} else {
+			m.fallback(name, args)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeItem struct {
+	title   string
+	tooltip string
+	checked bool
+	enabled bool
+	visible bool
+	clicked chan struct{}
+}
+
+func (i *fakeItem) SetTitle(title string)     { i.title = title }
+func (i *fakeItem) SetTooltip(tooltip string) { i.tooltip = tooltip }
+func (i *fakeItem) Check()                    { i.checked = true }
+func (i *fakeItem) Uncheck()                  { i.checked = false }
+func (i *fakeItem) Enable()                   { i.enabled = true }
+func (i *fakeItem) Disable()                  { i.enabled = false }
+func (i *fakeItem) Show()                     { i.visible = true }
+func (i *fakeItem) Hide()                     { i.visible = false }
+
+// fakeBackend records the items created, and "---" for the separators.
+type fakeBackend struct {
+	items   []*fakeItem
+	entries []string
+}
+
+func (b *fakeBackend) AddItem() (menuBackendItem, <-chan struct{}) {
+	item := &fakeItem{clicked: make(chan struct{})}
+	b.items = append(b.items, item)
+	b.entries = append(b.entries, "item")
+	return item, item.clicked
+}
+
+func (b *fakeBackend) AddSeparator() {
+	b.entries = append(b.entries, "---")
+}
+
+// visibleTitles returns the titles of the visible items, checked ones
+// marked with "*".
+func (b *fakeBackend) visibleTitles() []string {
+	var titles []string
+	for _, item := range b.items {
+		if !item.visible {
+			continue
+		}
+		title := item.title
+		if item.checked {
+			title = "*" + title
+		}
+		titles = append(titles, title)
+	}
+	return titles
+}
+
+func newTestMenu() (*menu, *fakeBackend, chan string) {
+	calls := make(chan string, 10)
+	m := newMenu(func(name string, args []string) {
+		calls <- name + " " + args[0]
+	})
+	m.addSection("top", 0,
+		&menuItem{ID: "proxy", Title: "Proxy", Action: "proxy.on", UncheckAction: "proxy.off", Args: []string{"x"}})
+	m.addSection("proc", 2,
+		&menuItem{ID: "proc:a", Title: "a", Action: "proc.start", Args: []string{"a"}},
+		&menuItem{ID: "v2ray", Title: "V2ray", Children: []*menuItem{
+			{ID: "v2ray:h1", Title: "h1", Action: "v2ray.switch", Args: []string{"h1"}, Checked: true},
+			{ID: "v2ray:h2", Title: "h2", Action: "v2ray.switch", Args: []string{"h2"}},
+		}})
+	b := &fakeBackend{}
+	m.realize(b)
+	return m, b, calls
+}
+
+func TestMenuRealize(t *testing.T) {
+	_, b, _ := newTestMenu()
+
+	// One slot in the first section, the rows of the second one and its
+	// two spare slots.
+	wantEntries := []string{"item", "---", "item", "item", "item", "item", "item", "item"}
+	if !reflect.DeepEqual(b.entries, wantEntries) {
+		t.Errorf("entries = %q, want %q", b.entries, wantEntries)
+	}
+	wantTitles := []string{"Proxy", "a", "V2ray", "*    h1", "    h2"}
+	if got := b.visibleTitles(); !reflect.DeepEqual(got, wantTitles) {
+		t.Errorf("titles = %q, want %q", got, wantTitles)
+	}
+	if b.items[2].enabled {
+		t.Errorf("submenu parent without action is enabled")
+	}
+}
+
+func TestMenuSetItems(t *testing.T) {
+	m, b, _ := newTestMenu()
+
+	tests := []struct {
+		items []*menuItem
+		want  []string
+	}{
+		{
+			[]*menuItem{{ID: "proc:a", Title: "a"}, {ID: "proc:b", Title: "b"}, {ID: "proc:c", Title: "c"}},
+			[]string{"Proxy", "a", "b", "c"},
+		},
+		{
+			// More rows than slots, the last ones are left out.
+			[]*menuItem{{Title: "1"}, {Title: "2"}, {Title: "3"}, {Title: "4"}, {Title: "5"}, {Title: "6"}, {Title: "7"}},
+			[]string{"Proxy", "1", "2", "3", "4", "5", "6"},
+		},
+		{
+			nil,
+			[]string{"Proxy"},
+		},
+	}
+	for _, test := range tests {
+		m.setItems("proc", test.items)
+		if got := b.visibleTitles(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("after setItems titles = %q, want %q", got, test.want)
+		}
+	}
+
+	// Unknown sections are ignored.
+	m.setItems("missing", []*menuItem{{Title: "x"}})
+	if got := b.visibleTitles(); !reflect.DeepEqual(got, []string{"Proxy"}) {
+		t.Errorf("after setItems of missing section titles = %q", got)
+	}
+}
+
+func TestMenuRemove(t *testing.T) {
+	m, b, _ := newTestMenu()
+
+	m.remove("v2ray:h1")
+	want := []string{"Proxy", "a", "V2ray", "    h2"}
+	if got := b.visibleTitles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after removing a child titles = %q, want %q", got, want)
+	}
+
+	m.remove("v2ray")
+	want = []string{"Proxy", "a"}
+	if got := b.visibleTitles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after removing a submenu titles = %q, want %q", got, want)
+	}
+
+	m.add("proc", &menuItem{ID: "proc:b", Title: "b"})
+	m.setChecked("proc:b", true)
+	m.setTitle("proc:a", "a (healthy)")
+	want = []string{"Proxy", "a (healthy)", "*b"}
+	if got := b.visibleTitles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after add titles = %q, want %q", got, want)
+	}
+}
+
+func TestMenuClick(t *testing.T) {
+	m, b, calls := newTestMenu()
+	handled := make(chan []string, 1)
+	m.handle("v2ray.switch", func(args []string) {
+		handled <- args
+	})
+
+	expect := func(what string, got <-chan string, want string) {
+		t.Helper()
+		select {
+		case call := <-got:
+			if call != want {
+				t.Errorf("%s: got %q, want %q", what, call, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: no call", what)
+		}
+	}
+
+	b.items[0].clicked <- struct{}{}
+	expect("click", calls, "proxy.on x")
+
+	m.setChecked("proxy", true)
+	b.items[0].clicked <- struct{}{}
+	expect("click on checked item", calls, "proxy.off x")
+
+	b.items[4].clicked <- struct{}{}
+	select {
+	case args := <-handled:
+		if !reflect.DeepEqual(args, []string{"h2"}) {
+			t.Errorf("handler args = %q, want [h2]", args)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler not called")
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var networkLog = componentLogger("network")
+
+const networkPollInterval = 10 * time.Second
+
+// networkConfig applies a profile, proxy and v2ray settings, and runs
+// actions, when the computer joins a network matching all of its
+// conditions.
+type networkConfig struct {
+	Name      string       `json:"name"`
+	SSID      string       `json:"ssid"`
+	Gateway   string       `json:"gateway"`
+	Interface string       `json:"interface"`
+	IP        string       `json:"ip"`
+	Profile   string       `json:"profile"`
+	Proxy     *bool        `json:"proxy"`
+	V2ray     string       `json:"v2ray"`
+	Actions   []actionStep `json:"actions"`
+}
+
+// networkState is what identifies the network the computer is in.
+type networkState struct {
+	Interfaces []string `json:"interfaces"`
+	IPs        []string `json:"ips"`
+	SSIDs      []string `json:"ssids"`
+	Gateways   []string `json:"gateways"`
+}
+
+type networkStatus struct {
+	Name string `json:"name,omitempty"`
+	networkState
+}
+
+func validateNetworks(problems *configProblems, file string, c *config) {
+	servers := make(map[string]bool)
+	for _, v2rayItem := range c.V2ray.Config {
+		servers[v2rayItem.Address] = true
+	}
+	profiles := make(map[string]bool)
+	for _, p := range c.Profiles {
+		profiles[p.Name] = true
+	}
+
+	names := make(map[string]bool)
+	for i, n := range c.Networks {
+		path := fmt.Sprintf("networks[%d]", i)
+		if n.Name == "" {
+			problems.add(file, path+".name", "required")
+		} else if names[n.Name] {
+			problems.add(file, path+".name", "duplicate name \"%s\"", n.Name)
+		}
+		names[n.Name] = true
+
+		if n.SSID == "" && n.Gateway == "" && n.Interface == "" && n.IP == "" {
+			problems.add(file, path, "need at least one of ssid, gateway, interface or ip")
+		}
+		if n.Gateway != "" && net.ParseIP(n.Gateway) == nil {
+			problems.add(file, path+".gateway", "invalid IP \"%s\"", n.Gateway)
+		}
+		if n.IP != "" {
+			if _, _, err := net.ParseCIDR(n.IP); err != nil {
+				problems.add(file, path+".ip", "invalid CIDR \"%s\"", n.IP)
+			}
+		}
+		if n.Profile != "" && !profiles[n.Profile] {
+			problems.add(file, path+".profile", "profile \"%s\" not found in config", n.Profile)
+		}
+		if n.V2ray != "" && !servers[n.V2ray] {
+			problems.add(file, path+".v2ray", "v2ray server \"%s\" not found in config", n.V2ray)
+		}
+		for j, step := range n.Actions {
+			if _, ok := actions[step.Action]; !ok {
+				problems.add(file, fmt.Sprintf("%s.actions[%d].action", path, j), "unknown action \"%s\"", step.Action)
+			}
+		}
+	}
+}
+
+// currentNetwork returns the up interfaces other than loopback with
+// their addresses, the Wi-Fi SSIDs and the default gateways.
+func currentNetwork() networkState {
+	var st networkState
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		networkLog.Errorf("List interfaces error: %s\n", err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		st.Interfaces = append(st.Interfaces, iface.Name)
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLinkLocalUnicast() {
+				st.IPs = append(st.IPs, ipnet.IP.String())
+			}
+		}
+	}
+	st.SSIDs = wifiSSIDs()
+	st.Gateways = defaultGateways()
+
+	for _, list := range [][]string{st.Interfaces, st.IPs, st.SSIDs, st.Gateways} {
+		sort.Strings(list)
+	}
+	return st
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (n networkConfig) match(st networkState) bool {
+	if n.SSID != "" && !contains(st.SSIDs, n.SSID) {
+		return false
+	}
+	if n.Gateway != "" && !contains(st.Gateways, net.ParseIP(n.Gateway).String()) {
+		return false
+	}
+	if n.Interface != "" && !contains(st.Interfaces, n.Interface) {
+		return false
+	}
+	if n.IP != "" {
+		_, cidr, err := net.ParseCIDR(n.IP)
+		if err != nil {
+			return false
+		}
+		found := false
+		for _, ip := range st.IPs {
+			if cidr.Contains(net.ParseIP(ip)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchNetwork returns the first network of the config matching, or nil.
+func matchNetwork(networks []networkConfig, st networkState) *networkConfig {
+	for i := range networks {
+		if networks[i].match(st) {
+			return &networks[i]
+		}
+	}
+	return nil
+}
+
+var (
+	networkMutex   sync.Mutex
+	currentNetName string
+)
+
+// runsHere tells if this instance applies the action for a network. The
+// proxy is per user, so it is set by the systray and not by the service.
+func runsHere(action string) bool {
+	proxy := strings.HasPrefix(action, "proxy.")
+	if thinClient {
+		return proxy
+	}
+	return !proxy || !*runAsService
+}
+
+func applyNetwork(n networkConfig) {
+	var steps []actionStep
+	if n.Profile != "" {
+		steps = append(steps, actionStep{Action: "profile.apply", Args: []string{n.Profile}})
+	}
+	if n.Proxy != nil {
+		if *n.Proxy {
+			steps = append(steps, actionStep{Action: "proxy.on"})
+		} else {
+			steps = append(steps, actionStep{Action: "proxy.off"})
+		}
+	}
+	if n.V2ray != "" {
+		steps = append(steps, actionStep{Action: "v2ray.switch", Args: []string{n.V2ray}})
+	}
+	steps = append(steps, n.Actions...)
+
+	for _, step := range steps {
+		if step.Action == "profile.apply" && thinClient {
+			applyProfileProxy(sourceNetwork, n.Profile)
+			continue
+		}
+		if !runsHere(step.Action) {
+			continue
+		}
+		if _, err := runAction(sourceNetwork, step.Action, step.Args); err != nil {
+			networkLog.Errorf("Network \"%s\": action \"%s\" error: %s\n", n.Name, step.Action, err)
+		}
+	}
+}
+
+// watchNetwork polls the network state, and applies the matching network
+// of the config when it changes to another one.
+func watchNetwork() {
+	var last networkState
+	first := true
+	for {
+		st := currentNetwork()
+		if first || !reflect.DeepEqual(st, last) {
+			networkLog.Infof("Network: interfaces %q, IPs %q, SSIDs %q, gateways %q\n", st.Interfaces, st.IPs, st.SSIDs, st.Gateways)
+
+			configMutex.RLock()
+			n := matchNetwork(cfg.Networks, st)
+			var matched networkConfig
+			if n != nil {
+				matched = *n
+			}
+			configMutex.RUnlock()
+
+			networkMutex.Lock()
+			changed := matched.Name != currentNetName
+			currentNetName = matched.Name
+			networkMutex.Unlock()
+
+			if changed && n != nil {
+				networkLog.Infof("Network \"%s\" joined, apply its settings\n", matched.Name)
+				applyNetwork(matched)
+			} else if changed {
+				networkLog.Infof("No network of the config matches\n")
+			}
+		}
+		last, first = st, false
+		time.Sleep(networkPollInterval)
+	}
+}
+
+func currentNetworkName() string {
+	networkMutex.Lock()
+	defer networkMutex.Unlock()
+	return currentNetName
+}
+
+// actionNetwork shows the network state, to find what to match on.
+func actionNetwork(args []string) (interface{}, error) {
+	if err := checkArgs(args, 0, "network"); err != nil {
+		return nil, err
+	}
+	ns := networkStatus{networkState: currentNetwork()}
+	if n := matchNetwork(cfg.Networks, ns.networkState); n != nil {
+		ns.Name = n.Name
+	}
+	return ns, nil
+}
@@ -0,0 +1,62 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"strings"
+)
+
+// defaultGateways reads the routes to 0.0.0.0/0 of /proc/net/route, whose
+// addresses are hex in host byte order.
+func defaultGateways() []string {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var gateways []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		b, err := hex.DecodeString(fields[2])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+		if !ip.IsUnspecified() && !contains(gateways, ip.String()) {
+			gateways = append(gateways, ip.String())
+		}
+	}
+	return gateways
+}
+
+// wifiSSIDs asks NetworkManager, or iwgetid without it. The scan results
+// are listed without a rescan, which polling would otherwise trigger.
+func wifiSSIDs() []string {
+	var ssids []string
+	if out, err := runCmdOutput("nmcli", "-t", "-f", "active,ssid", "dev", "wifi", "list", "--rescan", "no"); err == nil {
+		for _, line := range strings.Split(out, "\n") {
+			if ssid := strings.TrimPrefix(line, "yes:"); ssid != line && ssid != "" {
+				ssids = append(ssids, strings.Replace(ssid, `\:`, ":", -1))
+			}
+		}
+		return ssids
+	}
+	if out, err := runCmdOutput("iwgetid", "-r"); err == nil {
+		if ssid := strings.TrimSpace(out); ssid != "" {
+			ssids = append(ssids, ssid)
+		}
+	}
+	return ssids
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestMatchNetwork(t *testing.T) {
+	networks := []networkConfig{
+		{Name: "office", SSID: "corp", Gateway: "10.0.0.1"},
+		{Name: "home", SSID: "home"},
+		{Name: "vpn", Interface: "tun0", IP: "172.16.0.0/12"},
+		{Name: "lan", IP: "192.168.1.0/24"},
+	}
+	tests := []struct {
+		name string
+		st   networkState
+		want string
+	}{
+		{"nothing", networkState{}, ""},
+		{"ssid and gateway", networkState{SSIDs: []string{"corp"}, Gateways: []string{"10.0.0.1"}}, "office"},
+		{"ssid without gateway", networkState{SSIDs: []string{"corp"}, Gateways: []string{"10.0.0.254"}}, ""},
+		{"second ssid", networkState{SSIDs: []string{"guest", "home"}}, "home"},
+		{"first match wins", networkState{SSIDs: []string{"corp", "home"}, Gateways: []string{"10.0.0.1"}}, "office"},
+		{"interface and ip", networkState{Interfaces: []string{"eth0", "tun0"}, IPs: []string{"172.20.1.2"}}, "vpn"},
+		{"interface outside ip", networkState{Interfaces: []string{"tun0"}, IPs: []string{"10.8.0.2"}}, ""},
+		{"ip in cidr", networkState{IPs: []string{"fe80::1", "192.168.1.20"}}, "lan"},
+		{"ip outside cidr", networkState{IPs: []string{"192.168.2.20"}}, ""},
+	}
+	for _, test := range tests {
+		got := ""
+		if n := matchNetwork(networks, test.st); n != nil {
+			got = n.Name
+		}
+		if got != test.want {
+			t.Errorf("%s: matched %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMatchNetworkGateway(t *testing.T) {
+	n := networkConfig{Gateway: "::ffff:10.0.0.1"}
+	if !n.match(networkState{Gateways: []string{"10.0.0.1"}}) {
+		t.Error("gateway not compared as an IP")
+	}
+}
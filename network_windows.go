@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+)
+
+// defaultGateways parses the active routes to 0.0.0.0/0 printed by route.
+func defaultGateways() []string {
+	out, err := runCmdOutput("route", "print", "-4", "0.0.0.0")
+	if err != nil {
+		networkLog.Errorf("Run route print error: %s\n", err)
+		return nil
+	}
+
+	var gateways []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "0.0.0.0" || fields[1] != "0.0.0.0" {
+			continue
+		}
+		if gw := fields[2]; gw != "On-link" && !contains(gateways, gw) {
+			gateways = append(gateways, gw)
+		}
+	}
+	return gateways
+}
+
+// wifiSSIDs parses the "SSID : name" lines of the connected interfaces
+// printed by netsh, besides the BSSID ones.
+func wifiSSIDs() []string {
+	out, err := runCmdOutput("netsh", "wlan", "show", "interfaces")
+	if err != nil {
+		// Without the WLAN service there is no Wi-Fi.
+		return nil
+	}
+
+	var ssids []string
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) != "SSID" {
+			continue
+		}
+		if ssid := strings.TrimSpace(parts[1]); ssid != "" {
+			ssids = append(ssids, ssid)
+		}
+	}
+	return ssids
+}
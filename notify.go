@@ -0,0 +1,159 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// notifyRepeatInterval suppresses the same notification repeated within
+// it, e.g. by a proc restarting in a loop.
+const notifyRepeatInterval = time.Minute
+
+// Notification events. notifyEvents has whether each is enabled by
+// default, the notify section of config.json overrides it.
+const (
+	notifyProcFailed     = "proc_failed"
+	notifyProcUnhealthy  = "proc_unhealthy"
+	notifyProcState      = "proc_state"
+	notifyVMError        = "vm_error"
+	notifyV2rayError     = "v2ray_error"
+	notifyStartupFailed  = "startup_failed"
+	notifyScheduleFailed = "schedule_failed"
+	notifyConfigError    = "config_error"
+)
+
+var notifyEvents = map[string]bool{
+	notifyProcFailed:     true,
+	notifyProcUnhealthy:  true,
+	notifyProcState:      false,
+	notifyVMError:        true,
+	notifyV2rayError:     true,
+	notifyStartupFailed:  true,
+	notifyScheduleFailed: true,
+	notifyConfigError:    true,
+}
+
+var notifyLog = componentLogger("notify")
+
+var (
+	notifyMutex  sync.Mutex
+	lastNotified = make(map[string]time.Time)
+	// notifySettings is the notify section of the config, kept apart so
+	// that notify needs no configMutex.
+	notifySettings map[string]bool
+)
+
+// notification is shown on the desktop, or streamed to the systray by a
+// service without one.
+type notification struct {
+	Event   string `json:"event"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+var (
+	notificationSubscribers = make(map[int]func(notification))
+	nextNotificationID      int
+)
+
+// subscribeNotifications calls fn with the notifications of a service
+// without desktop until the returned function is called. fn must not
+// block.
+func subscribeNotifications(fn func(notification)) func() {
+	notifyMutex.Lock()
+	defer notifyMutex.Unlock()
+	id := nextNotificationID
+	nextNotificationID++
+	notificationSubscribers[id] = fn
+	return func() {
+		notifyMutex.Lock()
+		delete(notificationSubscribers, id)
+		notifyMutex.Unlock()
+	}
+}
+
+func setNotifyConfig(events map[string]bool) {
+	notifyMutex.Lock()
+	notifySettings = events
+	notifyMutex.Unlock()
+}
+
+func validateNotify(problems *configProblems, file string, events map[string]bool) {
+	for event := range events {
+		if _, ok := notifyEvents[event]; !ok {
+			var known []string
+			for e := range notifyEvents {
+				known = append(known, e)
+			}
+			sort.Strings(known)
+			problems.add(file, "notify."+event, "unknown event, must be one of %s", strings.Join(known, ", "))
+		}
+	}
+}
+
+func notifyEnabled(event string) bool {
+	notifyMutex.Lock()
+	enabled, ok := notifySettings[event]
+	notifyMutex.Unlock()
+	if ok {
+		return enabled
+	}
+	return notifyEvents[event]
+}
+
+// notify shows a desktop notification for the event if it is enabled.
+// A service without desktop streams it to the systray connected to it
+// instead.
+func notify(event, title, message string) {
+	if !notifyEnabled(event) {
+		return
+	}
+
+	n := notification{Event: event, Title: title, Message: message}
+	key := event + "\x00" + title + "\x00" + message
+	notifyMutex.Lock()
+	if time.Since(lastNotified[key]) < notifyRepeatInterval {
+		notifyMutex.Unlock()
+		return
+	}
+	lastNotified[key] = time.Now()
+	var subscribers []func(notification)
+	for _, fn := range notificationSubscribers {
+		subscribers = append(subscribers, fn)
+	}
+	notifyMutex.Unlock()
+
+	if *runAsService && !serviceHasDesktop {
+		for _, fn := range subscribers {
+			fn(n)
+		}
+		return
+	}
+	displayNotification(n)
+}
+
+// displayNotification shows the notification on the desktop of this
+// instance.
+func displayNotification(n notification) {
+	urgent := n.Event != notifyProcState
+	go func() {
+		if err := showNotification(n.Title, n.Message, urgent); err != nil {
+			notifyLog.Errorf("Show notification error: %s\n", err)
+		}
+	}()
+}
+
+// notifyProcEvent notifies the proc state transitions.
+func notifyProcEvent(e procEvent) {
+	if e.Prev == "" {
+		return
+	}
+	switch e.State {
+	case procFailed:
+		notify(notifyProcFailed, "CenCtl: proc failed", "Proc \""+e.Name+"\" failed or exited unexpectedly")
+	case procRunning, procStopped:
+		notify(notifyProcState, "CenCtl", "Proc \""+e.Name+"\" is "+e.State)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os/exec"
+)
+
+// serviceHasDesktop is true, the systemd user unit runs in the session
+// of the user.
+const serviceHasDesktop = true
+
+// showNotification sends a freedesktop notification over D-Bus with
+// notify-send.
+func showNotification(title, message string, urgent bool) error {
+	urgency := "normal"
+	if urgent {
+		urgency = "critical"
+	}
+	return exec.Command("notify-send", "--app-name=cenctl", "--urgency="+urgency, title, message).Run()
+}
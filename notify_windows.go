@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// serviceHasDesktop is false, a Windows service runs in session 0 where
+// no toast is seen.
+const serviceHasDesktop = false
+
+// toastAppID is the AppUserModelID of PowerShell, since toasts of an
+// unregistered app ID are not shown.
+const toastAppID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+
+// toastScript shows a toast with the title and message passed in the
+// environment, so that they need no quoting.
+const toastScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode($env:CENCTL_TITLE)) > $null
+$text.Item(1).AppendChild($template.CreateTextNode($env:CENCTL_MESSAGE)) > $null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($env:CENCTL_APP_ID).Show($toast)
+`
+
+// showNotification shows a Windows toast. Urgent toasts are not
+// different on Windows.
+func showNotification(title, message string, urgent bool) error {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript)
+	cmd.SysProcAttr = sysProcAttr()
+	cmd.Env = append(os.Environ(),
+		"CENCTL_TITLE="+title,
+		"CENCTL_MESSAGE="+message,
+		"CENCTL_APP_ID="+toastAppID)
+	return cmd.Run()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const dependencyTimeout = 2 * time.Minute
+
+// networkOnline reports whether an interface other than loopback is up
+// with a global unicast address.
+func networkOnline() bool {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		procLog.Errorf("List network interfaces error: %s\n", err)
+		return false
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func waitReady(what string, ready func() bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !ready() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s not ready after %s", what, timeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+	return nil
+}
+
+// waitProcRunning waits for p, started here or by another proc depending
+// on it, to run.
+func waitProcRunning(p proc) error {
+	deadline := time.Now().Add(dependencyTimeout)
+	for {
+		switch state := procState(p.Name); {
+		case state == procRunning && p.started():
+			return nil
+		case !procActive(state):
+			return fmt.Errorf("proc \"%s\" is %s", p.Name, state)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("proc \"%s\" not ready after %s", p.Name, dependencyTimeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// startDependencies starts the procs p depends on and waits for them,
+// and for the VM and the network if p depends on them. What it needs of
+// the config is copied first, the waits do not hold configMutex.
+func startDependencies(p proc) error {
+	configMutex.RLock()
+	sshHost := cfg.VBox.SSHHost
+	deps := make(map[string]proc)
+	for _, dep := range p.DependsOn {
+		if dp, err := findProc(dep); err == nil {
+			deps[dep] = dp
+		}
+	}
+	configMutex.RUnlock()
+
+	for _, dep := range p.DependsOn {
+		var err error
+		switch dep {
+		case "vm":
+			err = waitReady("VM", func() bool { return sshReady(sshHost) }, dependencyTimeout)
+		case "network":
+			err = waitReady("network", networkOnline, dependencyTimeout)
+		default:
+			dp, ok := deps[dep]
+			if !ok {
+				err = fmt.Errorf("proc \"%s\" not found in config", dep)
+				break
+			}
+			procLog.Debugf("Proc \"%s\" needs \"%s\"\n", p.Name, dp.Name)
+			if err = startProc(dp); err == nil {
+				err = waitProcRunning(dp)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("dependency of proc \"%s\": %s", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// stopDependents stops the running procs depending on name, which is a
+// proc name or "vm", the deepest dependents first. procs are those of the
+// config, copied by the caller.
+func stopDependents(name string, procs []proc) {
+	for _, p := range procs {
+		for _, dep := range p.DependsOn {
+			if dep == name && p.started() {
+				procLog.Infof("Stop proc \"%s\" depending on \"%s\"\n", p.Name, name)
+				stopProc(p, procs)
+				break
+			}
+		}
+	}
+}
+
+func validateDependencies(problems *configProblems, file string, procs []proc) {
+	names := make(map[string]bool)
+	for _, p := range procs {
+		names[p.Name] = true
+	}
+
+	for i, p := range procs {
+		for j, dep := range p.DependsOn {
+			path := fmt.Sprintf("proc[%d].depends_on[%d]", i, j)
+			switch {
+			case dep == "vm" || dep == "network":
+			case dep == p.Name:
+				problems.add(file, path, "proc can not depend on itself")
+			case !names[dep]:
+				problems.add(file, path, "unknown proc \"%s\", expect a proc name, vm or network", dep)
+			}
+		}
+	}
+
+	// Find cycles with a depth-first search, 1 is visiting and 2 is done.
+	state := make(map[string]int)
+	var visit func(i int) bool
+	visit = func(i int) bool {
+		p := procs[i]
+		state[p.Name] = 1
+		for _, dep := range p.DependsOn {
+			for j, q := range procs {
+				if q.Name != dep || dep == p.Name {
+					continue
+				}
+				if state[dep] == 1 || (state[dep] == 0 && visit(j)) {
+					return true
+				}
+			}
+		}
+		state[p.Name] = 2
+		return false
+	}
+	for i, p := range procs {
+		if state[p.Name] == 0 && visit(i) {
+			problems.add(file, fmt.Sprintf("proc[%d].depends_on", i), "dependency cycle through \"%s\"", p.Name)
+			return
+		}
+	}
+}
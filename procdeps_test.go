@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateDependencies(t *testing.T) {
+	p := func(name string, deps ...string) proc {
+		return proc{Name: name, DependsOn: deps}
+	}
+	tests := []struct {
+		name  string
+		procs []proc
+		want  []string
+	}{
+		{"none", []proc{p("a"), p("b")}, nil},
+		{"chain", []proc{p("a", "b"), p("b", "c", "vm"), p("c", "network")}, nil},
+		{"diamond", []proc{p("a", "b", "c"), p("b", "d"), p("c", "d"), p("d")}, nil},
+		{"self", []proc{p("a", "a")}, []string{"proc[0].depends_on[0]"}},
+		{"unknown", []proc{p("a", "x")}, []string{"proc[0].depends_on[0]"}},
+		{"cycle of two", []proc{p("a", "b"), p("b", "a")}, []string{"proc[0].depends_on"}},
+		{"cycle of three", []proc{p("x"), p("a", "b"), p("b", "c"), p("c", "a")}, []string{"proc[1].depends_on"}},
+		{"cycle not through the first", []proc{p("a", "b"), p("b", "c"), p("c", "b")}, []string{"proc[0].depends_on"}},
+	}
+	for _, test := range tests {
+		var problems configProblems
+		validateDependencies(&problems, "config.json", test.procs)
+		var paths []string
+		for _, problem := range problems {
+			paths = append(paths, problem.Path)
+		}
+		if !reflect.DeepEqual(paths, test.want) {
+			t.Errorf("%s: problems at %q, want %q (%s)", test.name, paths, test.want, problems)
+		}
+	}
+}
+
+func TestClaimProcStart(t *testing.T) {
+	const name = "cenctl-test-claim"
+	setProcState(name, procStopped)
+
+	claims := make(chan bool)
+	for i := 0; i < 8; i++ {
+		go func() { claims <- claimProcStart(name) }()
+	}
+	n := 0
+	for i := 0; i < 8; i++ {
+		if <-claims {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("%d callers claimed the start, want 1", n)
+	}
+	if state := procState(name); state != procStarting {
+		t.Errorf("state %s, want %s", state, procStarting)
+	}
+
+	for state, want := range map[string]bool{
+		procStarting: false,
+		procRunning:  false,
+		procStopping: false,
+		procStopped:  true,
+		procFailed:   true,
+	} {
+		setProcState(name, state)
+		if got := claimProcStart(name); got != want {
+			t.Errorf("claim of a %s proc = %v, want %v", state, got, want)
+		}
+	}
+}
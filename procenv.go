@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func envFilePath(file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(appDir, file)
+}
+
+// parseEnvFile reads KEY=VALUE lines. Blank lines and lines starting
+// with # are skipped, and quotes around the value are removed.
+func parseEnvFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var env []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || key == "" {
+			return nil, fmt.Errorf("%s: line %d: expect KEY=VALUE", file, n)
+		}
+		value := strings.TrimSpace(parts[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env = append(env, key+"="+value)
+	}
+	return env, scanner.Err()
+}
+
+// environ is the environment of cenctl with env_file and env added, env
+// taking precedence. Secret references in the values are resolved.
+func (p proc) environ() ([]string, error) {
+	var extra []string
+	if p.EnvFile != "" {
+		lines, err := parseEnvFile(envFilePath(p.EnvFile))
+		if err != nil {
+			return nil, err
+		}
+		extra = append(extra, lines...)
+	}
+
+	keys := make([]string, 0, len(p.Env))
+	for key := range p.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		extra = append(extra, key+"="+p.Env[key])
+	}
+
+	env := os.Environ()
+	for _, kv := range extra {
+		parts := strings.SplitN(kv, "=", 2)
+		value, err := resolveSecret(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("env %s: %s", parts[0], err)
+		}
+		env = append(env, parts[0]+"="+value)
+	}
+	return env, nil
+}
+
+func (p proc) command() (*exec.Cmd, error) {
+	args, err := resolveSecrets(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	env, err := p.environ()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(p.Path, args...)
+	cmd.SysProcAttr = sysProcAttr()
+	cmd.Dir = p.Cwd
+	cmd.Env = env
+	return cmd, nil
+}
+
+func validateProcEnv(problems *configProblems, file, path string, p proc) {
+	if p.Cwd != "" {
+		if info, err := os.Stat(p.Cwd); err != nil {
+			problems.add(file, path+".cwd", "%s", err)
+		} else if !info.IsDir() {
+			problems.add(file, path+".cwd", "\"%s\" is not a directory", p.Cwd)
+		}
+	}
+	if p.EnvFile != "" {
+		if _, err := parseEnvFile(envFilePath(p.EnvFile)); err != nil {
+			problems.add(file, path+".env_file", "%s", err)
+		}
+	}
+	for key, value := range p.Env {
+		if key == "" || strings.ContainsAny(key, "= ") {
+			problems.add(file, path+".env", "invalid name \"%s\"", key)
+		}
+		checkSecretRef(problems, file, path+".env."+key, value)
+	}
+	for i, arg := range p.Args {
+		checkSecretRef(problems, file, fmt.Sprintf("%s.args[%d]", path, i), arg)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+var procLog = componentLogger("proc")
+
+const procPollInterval = 2 * time.Second
+
+const (
+	procStopped  = "stopped"
+	procStarting = "starting"
+	procRunning  = "running"
+	procStopping = "stopping"
+	procFailed   = "failed"
+)
+
+// procEvent is a transition of the state of a proc, or a change of its
+// health with no Prev.
+type procEvent struct {
+	Name   string    `json:"name"`
+	State  string    `json:"state"`
+	Prev   string    `json:"prev,omitempty"`
+	Health string    `json:"health,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+var (
+	procStateMutex   sync.Mutex
+	procStates       = make(map[string]string)
+	procSubscribers  = make(map[int]func(procEvent))
+	nextSubscriberID int
+)
+
+// subscribeProcState calls fn on every transition until the returned
+// function is called. fn must not block.
+func subscribeProcState(fn func(procEvent)) func() {
+	procStateMutex.Lock()
+	defer procStateMutex.Unlock()
+	id := nextSubscriberID
+	nextSubscriberID++
+	procSubscribers[id] = fn
+	return func() {
+		procStateMutex.Lock()
+		delete(procSubscribers, id)
+		procStateMutex.Unlock()
+	}
+}
+
+// procState returns the known state of the proc, and looks at the
+// running processes if it has none yet.
+func procState(name string) string {
+	procStateMutex.Lock()
+	state, ok := procStates[name]
+	procStateMutex.Unlock()
+	if ok {
+		return state
+	}
+
+	state = procStopped
+	if processRunning(name) {
+		state = procRunning
+	}
+	setProcState(name, state)
+	return state
+}
+
+func procActive(state string) bool {
+	return state == procStarting || state == procRunning
+}
+
+var (
+	startGuardsMutex sync.Mutex
+	startGuards      = make(map[string]*sync.Mutex)
+)
+
+// claimProcStart marks the proc as starting if it is stopped or failed,
+// and tells if the caller is the one to start it. The
+// check and the mark are done under a guard per proc, so that two procs
+// depending on it do not both start it.
+func claimProcStart(name string) bool {
+	startGuardsMutex.Lock()
+	guard, ok := startGuards[name]
+	if !ok {
+		guard = new(sync.Mutex)
+		startGuards[name] = guard
+	}
+	startGuardsMutex.Unlock()
+
+	guard.Lock()
+	defer guard.Unlock()
+	if state := procState(name); state != procStopped && state != procFailed {
+		return false
+	}
+	setProcState(name, procStarting)
+	return true
+}
+
+func setProcState(name, state string) {
+	health := procHealth(name)
+	procStateMutex.Lock()
+	old, ok := procStates[name]
+	if ok && old == state {
+		procStateMutex.Unlock()
+		return
+	}
+	procStates[name] = state
+	procStateMutex.Unlock()
+
+	if ok {
+		procLog.Infof("Proc \"%s\" is %s\n", name, state)
+	}
+	publishProcEvent(procEvent{Name: name, State: state, Prev: old, Health: health, Time: time.Now()})
+}
+
+func publishProcEvent(e procEvent) {
+	procStateMutex.Lock()
+	var subscribers []func(procEvent)
+	for _, fn := range procSubscribers {
+		subscribers = append(subscribers, fn)
+	}
+	procStateMutex.Unlock()
+
+	for _, fn := range subscribers {
+		fn(e)
+	}
+}
+
+// procExited records the exit of a proc started by cenctl. An exit that
+// was not asked for is a failure.
+func procExited(name string, err error) {
+	procStateMutex.Lock()
+	state := procStates[name]
+	procStateMutex.Unlock()
+
+	if state == procStopping || err == nil {
+		setProcState(name, procStopped)
+	} else {
+		setProcState(name, procFailed)
+	}
+}
+
+// pollProcStates catches the procs started or stopped outside of
+// cenctl. A proc being started or stopped is left alone.
+func pollProcStates() {
+	for range time.Tick(procPollInterval) {
+		configMutex.RLock()
+		procs := append([]proc(nil), cfg.Proc...)
+		configMutex.RUnlock()
+
+		for _, p := range procs {
+			state := procState(p.Name)
+			if state == procStarting || state == procStopping {
+				continue
+			}
+			running := processRunning(p.Name)
+			switch {
+			case running && state != procRunning:
+				setProcState(p.Name, procRunning)
+			case !running && state == procRunning:
+				setProcState(p.Name, procFailed)
+			}
+		}
+	}
+}
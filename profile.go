@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var profileLog = componentLogger("profile")
+
+// The profile actions run other actions, so they are registered here to
+// not refer to the actions map in its own initialization.
+func init() {
+	actions["profile.apply"] = actionProfileApply
+	actions["profile.list"] = actionProfileList
+}
+
+// profileConfig is a target state. Unset fields are left as they are,
+// "procs": [] stops all the procs.
+type profileConfig struct {
+	Name         string   `json:"name"`
+	Proxy        *bool    `json:"proxy"`
+	ProxyAddress string   `json:"proxy_address"`
+	V2ray        string   `json:"v2ray"`
+	Procs        []string `json:"procs"`
+	VM           *bool    `json:"vm"`
+}
+
+type profileStatus struct {
+	Name    string `json:"name"`
+	Current bool   `json:"current"`
+}
+
+var (
+	profileMutex   sync.Mutex
+	currentProfile string
+)
+
+func validateProfiles(problems *configProblems, file string, c *config) {
+	servers := make(map[string]bool)
+	for _, v2rayItem := range c.V2ray.Config {
+		servers[v2rayItem.Address] = true
+	}
+	procs := make(map[string]bool)
+	for _, p := range c.Proc {
+		procs[p.Name] = true
+	}
+
+	names := make(map[string]bool)
+	for i, p := range c.Profiles {
+		path := fmt.Sprintf("profiles[%d]", i)
+		if p.Name == "" {
+			problems.add(file, path+".name", "required")
+		} else if names[p.Name] {
+			problems.add(file, path+".name", "duplicate name \"%s\"", p.Name)
+		}
+		names[p.Name] = true
+
+		if p.ProxyAddress != "" {
+			if p.Proxy == nil || !*p.Proxy {
+				problems.add(file, path+".proxy_address", "needs \"proxy\": true")
+			}
+			checkHostPort(problems, file, path+".proxy_address", p.ProxyAddress)
+		}
+		if p.V2ray != "" && !servers[p.V2ray] {
+			problems.add(file, path+".v2ray", "v2ray server \"%s\" not found in config", p.V2ray)
+		}
+		for j, name := range p.Procs {
+			if !procs[name] {
+				problems.add(file, fmt.Sprintf("%s.procs[%d]", path, j), "proc \"%s\" not found in config", name)
+			}
+		}
+	}
+}
+
+func findProfile(name string) (profileConfig, error) {
+	for _, p := range cfg.Profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return profileConfig{}, fmt.Errorf("profile \"%s\" not found in config", name)
+}
+
+// proxySteps sets the proxy of the profile.
+func (p profileConfig) proxySteps() []actionStep {
+	switch {
+	case p.Proxy == nil:
+		return nil
+	case !*p.Proxy:
+		if ieProxyEnabled() {
+			return []actionStep{{Action: "proxy.off"}}
+		}
+	case p.ProxyAddress != "":
+		return []actionStep{{Action: "proxy.on", Args: []string{p.ProxyAddress}}}
+	case !ieProxyEnabled():
+		return []actionStep{{Action: "proxy.on"}}
+	}
+	return nil
+}
+
+// steps returns the actions moving from the current state to the
+// profile: the VM is started first and powered off last, and the procs
+// not in the profile are stopped before the others are started.
+func (p profileConfig) steps() []actionStep {
+	var steps []actionStep
+	vmRunning := vmState() == "running"
+	if p.VM != nil && *p.VM && !vmRunning {
+		steps = append(steps, actionStep{Action: "vm.start"})
+	}
+
+	var starts []actionStep
+	if p.Procs != nil {
+		for _, pc := range cfg.Proc {
+			want := contains(p.Procs, pc.Name)
+			active := procActive(procState(pc.Name))
+			if active && !want {
+				steps = append(steps, actionStep{Action: "proc.stop", Args: []string{pc.Name}})
+			} else if want && !active {
+				starts = append(starts, actionStep{Action: "proc.start", Args: []string{pc.Name}})
+			}
+		}
+	}
+	if p.V2ray != "" && p.V2ray != currentV2rayConfig() {
+		steps = append(steps, actionStep{Action: "v2ray.switch", Args: []string{p.V2ray}})
+	}
+	steps = append(steps, starts...)
+	steps = append(steps, p.proxySteps()...)
+
+	if p.VM != nil && !*p.VM && vmRunning {
+		steps = append(steps, actionStep{Action: "vm.stop"})
+	}
+	return steps
+}
+
+func setCurrentProfile(name string) {
+	profileMutex.Lock()
+	currentProfile = name
+	profileMutex.Unlock()
+
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	for _, p := range cfg.Profiles {
+		trayMenu.setChecked("profile:"+p.Name, p.Name == name)
+	}
+}
+
+func currentProfileName() string {
+	profileMutex.Lock()
+	defer profileMutex.Unlock()
+	return currentProfile
+}
+
+// actionProfileApply runs the steps to the profile, and returns them.
+// The proxy is left to the systray under the service. The steps are run
+// without configMutex, since starting a proc waits for its dependencies.
+func actionProfileApply(args []string) (interface{}, error) {
+	if err := checkArgs(args, 1, "profile apply <name>"); err != nil {
+		return nil, err
+	}
+	p, err := findProfile(args[0])
+	if err != nil {
+		return nil, err
+	}
+	steps := p.steps()
+
+	return unlockedAction(func() (interface{}, error) {
+		profileLog.Infof("Apply profile \"%s\"\n", p.Name)
+		done := []actionStep{}
+		for _, step := range steps {
+			if !runsHere(step.Action) {
+				continue
+			}
+			profileLog.Infof("Profile \"%s\": %s %q\n", p.Name, step.Action, step.Args)
+			if _, err := callAction(step.Action, step.Args); err != nil {
+				return done, fmt.Errorf("profile \"%s\": %s: %s", p.Name, step.Action, err)
+			}
+			done = append(done, step)
+		}
+		setCurrentProfile(p.Name)
+		return done, nil
+	}), nil
+}
+
+func actionProfileList(args []string) (interface{}, error) {
+	if err := checkArgs(args, 0, "profile list"); err != nil {
+		return nil, err
+	}
+	current := currentProfileName()
+	profiles := []profileStatus{}
+	for _, p := range cfg.Profiles {
+		profiles = append(profiles, profileStatus{Name: p.Name, Current: p.Name == current})
+	}
+	return profiles, nil
+}
+
+// applyProfileProxy sets the proxy of the profile in the systray
+// connected to the running instance, which leaves it out as a service.
+func applyProfileProxy(source, name string) {
+	configMutex.RLock()
+	p, err := findProfile(name)
+	configMutex.RUnlock()
+	if err != nil {
+		profileLog.Errorf("%s\n", err)
+		return
+	}
+	for _, step := range p.proxySteps() {
+		if _, err := runAction(source, step.Action, step.Args); err != nil {
+			profileLog.Errorf("Profile \"%s\": action \"%s\" error: %s\n", name, step.Action, err)
+		}
+	}
+}
+
+// addProfileProxy sets on the command line the proxy of the profile
+// applied by the running instance, if it left it out as a service, and
+// adds the steps to its result.
+func addProfileProxy(result json.RawMessage, name string) (json.RawMessage, error) {
+	var steps []actionStep
+	if err := json.Unmarshal(result, &steps); err != nil {
+		return nil, err
+	}
+	for _, step := range steps {
+		if strings.HasPrefix(step.Action, "proxy.") {
+			return result, nil
+		}
+	}
+
+	p, err := findProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range p.proxySteps() {
+		if _, err := runAction(sourceCLI, step.Action, step.Args); err != nil {
+			return nil, fmt.Errorf("profile \"%s\": %s: %s", name, step.Action, err)
+		}
+		steps = append(steps, step)
+	}
+	return json.Marshal(steps)
+}
+
+func profileMenuItems() []*menuItem {
+	current := currentProfileName()
+	parent := &menuItem{ID: "profile", Title: "Profile"}
+	for _, p := range cfg.Profiles {
+		parent.Children = append(parent.Children, &menuItem{
+			ID:      "profile:" + p.Name,
+			Title:   p.Name,
+			Action:  "profile.apply",
+			Args:    []string{p.Name},
+			Checked: p.Name == current,
+		})
+	}
+	return []*menuItem{parent}
+}
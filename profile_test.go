@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAddProfileProxy(t *testing.T) {
+	defer useTestConfig([]string{"a"}, "host1")()
+	cfg.Profiles = []profileConfig{{Name: "work", Procs: []string{"a"}}}
+
+	applied := json.RawMessage(`[{"action":"proc.start","args":["a"]},{"action":"proxy.off"}]`)
+	if result, err := addProfileProxy(applied, "work"); err != nil || string(result) != string(applied) {
+		t.Errorf("proxy set by the instance: %s, %v", result, err)
+	}
+
+	result, err := addProfileProxy(json.RawMessage(`[{"action":"proc.start","args":["a"]}]`), "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var steps []actionStep
+	json.Unmarshal(result, &steps)
+	if want := []actionStep{{Action: "proc.start", Args: []string{"a"}}}; !reflect.DeepEqual(steps, want) {
+		t.Errorf("profile without proxy: steps %+v, want %+v", steps, want)
+	}
+
+	if _, err := addProfileProxy(json.RawMessage(`[]`), "home"); err == nil {
+		t.Error("unknown profile: no error")
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"net"
+	"strings"
+)
+
+func gsettings(arg ...string) (string, error) {
+	out, err := runCmdOutput("gsettings", arg...)
+	if err != nil {
+		proxyLog.Errorf("Run gsettings %q error: %s\n", arg, err)
+	}
+	return strings.TrimSpace(out), err
+}
+
+func enableIEProxy(addr string) {
+	host, port, _ := net.SplitHostPort(addr)
+	gsettings("set", "org.gnome.system.proxy.http", "host", host)
+	gsettings("set", "org.gnome.system.proxy.http", "port", port)
+	gsettings("set", "org.gnome.system.proxy.https", "host", host)
+	gsettings("set", "org.gnome.system.proxy.https", "port", port)
+	gsettings("set", "org.gnome.system.proxy", "ignore-hosts", "['localhost', '127.0.0.0/8', '10.0.0.0/8', '172.16.0.0/12', '192.168.0.0/16']")
+	gsettings("set", "org.gnome.system.proxy", "mode", "manual")
+}
+
+func disableIEProxy() {
+	gsettings("set", "org.gnome.system.proxy", "mode", "none")
+}
+
+func ieProxyEnabled() bool {
+	mode, err := gsettings("get", "org.gnome.system.proxy", "mode")
+	return err == nil && mode == "'manual'"
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+var (
+	wininet, _           = syscall.LoadLibrary("wininet.dll")
+	internetSetOption, _ = syscall.GetProcAddress(wininet, "InternetSetOptionW")
+)
+
+func updateIEOption() {
+	ret, _, callErr := syscall.Syscall6(uintptr(internetSetOption),
+		4,
+		0,
+		95,
+		0,
+		0,
+		0,
+		0)
+	if callErr != 0 {
+		proxyLog.Errorf("Call InternetSetOption error: %s\n", callErr)
+	}
+	if ret == 0 {
+		proxyLog.Errorf("Run InternetSetOption error\n")
+	}
+	return
+}
+
+func enableIEProxy(addr string) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Internet Settings`, registry.ALL_ACCESS)
+	if err != nil {
+		proxyLog.Errorf("Open internet settings error: %s\n", err)
+		return
+	}
+	defer key.Close()
+
+	key.SetStringValue("ProxyOverride", "<local>;localhost;127.*;10.*;172.16.*;172.17.*;172.18.*;172.19.*;172.20.*;172.21.*;172.22.*;172.23.*;172.24.*;172.25.*;172.26.*;172.27.*;172.28.*;172.29.*;172.30.*;172.31.*;192.168.*")
+	key.SetStringValue("ProxyServer", addr)
+	key.SetDWordValue("ProxyEnable", 1)
+
+	updateIEOption()
+}
+
+func ieProxyEnabled() bool {
+	key, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Internet Settings`, registry.QUERY_VALUE)
+	if err != nil {
+		proxyLog.Errorf("Open internet settings error: %s\n", err)
+		return false
+	}
+	defer key.Close()
+
+	enable, _, err := key.GetIntegerValue("ProxyEnable")
+	if err != nil {
+		return false
+	}
+	return enable != 0
+}
+
+func disableIEProxy() {
+	key, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Internet Settings`, registry.ALL_ACCESS)
+	if err != nil {
+		proxyLog.Errorf("Open internet settings error: %s\n", err)
+		return
+	}
+	defer key.Close()
+
+	key.SetDWordValue("ProxyEnable", 0)
+
+	updateIEOption()
+}
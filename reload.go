@@ -0,0 +1,193 @@
+package main
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var configLog = componentLogger("config")
+
+const configPollInterval = 2 * time.Second
+
+// configMutex is held for reading by the actions, and for writing when
+// the config is swapped on reload.
+var configMutex sync.RWMutex
+
+// configSnapshot returns the config for the code running without
+// configMutex. The config is replaced on reload and never changed in
+// place, so the copy stays consistent.
+func configSnapshot() config {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return cfg
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func stampFiles(files ...string) []fileStamp {
+	var stamps []fileStamp
+	for _, file := range files {
+		var stamp fileStamp
+		if info, err := os.Stat(file); err == nil {
+			stamp = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+		stamps = append(stamps, stamp)
+	}
+	return stamps
+}
+
+func watchedFiles(dir string) []string {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return []string{path.Join(dir, configFilename), path.Join(cfg.V2ray.Dir, cfg.V2ray.ConfigFile)}
+}
+
+// watchConfig polls config.json and the v2ray config, and reloads them
+// when either changes.
+func watchConfig(dir string) {
+	last := stampFiles(watchedFiles(dir)...)
+	for range time.Tick(configPollInterval) {
+		current := stampFiles(watchedFiles(dir)...)
+		if reflect.DeepEqual(current, last) {
+			continue
+		}
+		reloadConfig(dir)
+		last = stampFiles(watchedFiles(dir)...)
+	}
+}
+
+func reloadConfig(dir string) {
+	c, problems := readConfig(path.Join(dir, configFilename))
+	if len(problems) > 0 {
+		configLog.Errorf("Reload config error, keep the current config:\n%s\n", problems)
+		notify(notifyConfigError, "CenCtl: config not reloaded", problems.Error())
+		return
+	}
+	newV2ray, problems := readV2rayConfig(path.Join(c.V2ray.Dir, c.V2ray.ConfigFile))
+	if len(problems) > 0 {
+		configLog.Errorf("Reload v2ray config error, keep the current config:\n%s\n", problems)
+		notify(notifyConfigError, "CenCtl: v2ray config not reloaded", problems.Error())
+		return
+	}
+
+	// v2rayMutex is taken first, a switch of v2ray holds it without
+	// configMutex.
+	v2rayMutex.Lock()
+	configMutex.Lock()
+	old := cfg
+	cfg = c
+	setSecretsConfig(c.Secrets)
+	setNotifyConfig(c.Notify)
+	setV2rayConfig(newV2ray)
+	configMutex.Unlock()
+	v2rayMutex.Unlock()
+	configureLogging(c.Log)
+	configureEvents(c.Events)
+	configLog.Infof("Config reloaded")
+
+	if old.API.Addr != c.API.Addr {
+		configLog.Warnf("Control API address changed, restart to apply")
+	}
+
+	if !thinClient {
+		applyProcChanges(old.Proc, c.Proc)
+		applyV2rayChange()
+	}
+
+	if trayMenu != nil {
+		trayMenu.setItems("v2ray", v2rayMenuItems())
+		trayMenu.setItems("proc", procMenuItems())
+		trayMenu.setItems("profile", profileMenuItems())
+		trayMenu.setItems("custom", customMenuItems(c.Menu, "custom:"))
+		if thinClient {
+			refreshMenu()
+		}
+	}
+}
+
+func findProcIn(procs []proc, name string) (proc, bool) {
+	for _, p := range procs {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return proc{}, false
+}
+
+func procCommandChanged(a, b proc) bool {
+	return a.Path != b.Path || a.Cwd != b.Cwd || a.EnvFile != b.EnvFile ||
+		!reflect.DeepEqual(a.Args, b.Args) || !reflect.DeepEqual(a.Env, b.Env)
+}
+
+// applyProcChanges stops the removed procs, restarts the running procs
+// whose command or environment changed, and starts the new procs with
+// auto_start. Other procs, including those depending on a restarted
+// proc, are left alone.
+func applyProcChanges(oldProcs, newProcs []proc) {
+	for _, p := range oldProcs {
+		if _, ok := findProcIn(newProcs, p.Name); !ok && p.started() {
+			configLog.Infof("Proc \"%s\" removed from config\n", p.Name)
+			start := time.Now()
+			stopProc(p, newProcs)
+			recordAction(sourceConfig, "proc.stop", []string{p.Name}, start, nil)
+		}
+	}
+
+	for _, p := range newProcs {
+		op, ok := findProcIn(oldProcs, p.Name)
+		switch {
+		case !ok:
+			if p.AutoStart && !p.started() {
+				configLog.Infof("Proc \"%s\" added to config\n", p.Name)
+				start := time.Now()
+				err := startProc(p)
+				if err != nil {
+					configLog.Errorf("Start proc error: %s\n", err)
+				}
+				recordAction(sourceConfig, "proc.start", []string{p.Name}, start, err)
+			}
+		case procCommandChanged(op, p):
+			if p.started() {
+				configLog.Infof("Proc \"%s\" changed in config, restart it\n", p.Name)
+				start := time.Now()
+				err := restartProc(p)
+				if err != nil {
+					configLog.Errorf("Restart proc error: %s\n", err)
+				}
+				recordAction(sourceConfig, "proc.restart", []string{p.Name}, start, err)
+			}
+		}
+	}
+}
+
+// applyV2rayChange switches v2ray again if the port or id of the current
+// server changed in config.json.
+func applyV2rayChange() {
+	v2rayMutex.Lock()
+	address, port, id := currentV2rayServer()
+	v2rayMutex.Unlock()
+
+	for _, v2rayItem := range cfg.V2ray.Config {
+		if v2rayItem.Address != address {
+			continue
+		}
+		newID, err := resolveSecret(v2rayItem.ID)
+		if err != nil {
+			configLog.Errorf("V2ray server \"%s\": %s\n", address, err)
+			return
+		}
+		if v2rayItem.Port != port || newID != id {
+			configLog.Infof("V2ray server \"%s\" changed in config\n", address)
+			if err := selectV2ray(cfg.V2ray, address); err != nil {
+				configLog.Errorf("Switch v2ray error: %s\n", err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var scheduleLog = componentLogger("schedule")
+
+// scheduleEntry runs an action at the times matching a cron expression.
+type scheduleEntry struct {
+	Name   string   `json:"name"`
+	Cron   string   `json:"cron"`
+	Action string   `json:"action"`
+	Args   []string `json:"args"`
+}
+
+// cronSpec is a parsed cron expression, a bit set of the allowed values
+// of each field.
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	// With both the day of month and the day of week restricted, a day
+	// matching either of them matches, as in cron.
+	domStar, dowStar bool
+}
+
+var cronShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dowNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// parseCron parses the five fields minute, hour, day of month, month and
+// day of week. Each is *, a value, a range a-b, a list, with an optional
+// step /n. Months and days of week also take their three letter names,
+// and 7 is Sunday too.
+func parseCron(expr string) (*cronSpec, error) {
+	if s, ok := cronShortcuts[strings.TrimSpace(expr)]; ok {
+		expr = s
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expect 5 fields, got %d", len(fields))
+	}
+
+	c := &cronSpec{domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %s", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %s", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %s", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("month: %s", err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, dowNames); err != nil {
+		return nil, fmt.Errorf("day of week: %s", err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func parseCronField(field string, min, max int, names []string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in \"%s\"", part)
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = parseCronValue(bounds[0], min, max, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = parseCronValue(bounds[1], min, max, names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = max
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range \"%s\"", rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(s string, min, max int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(s, name) {
+			return i + min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("invalid value \"%s\", expect %d-%d", s, min, max)
+	}
+	return v, nil
+}
+
+func (c *cronSpec) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (c *cronSpec) match(t time.Time) bool {
+	return c.minute&(1<<uint(t.Minute())) != 0 &&
+		c.hour&(1<<uint(t.Hour())) != 0 &&
+		c.month&(1<<uint(t.Month())) != 0 &&
+		c.matchDay(t)
+}
+
+// next returns the first time matching after t, or the zero time if
+// there is none in the next five years, e.g. for February 30.
+func (c *cronSpec) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func validateSchedule(problems *configProblems, file string, entries []scheduleEntry) {
+	names := make(map[string]bool)
+	for i, e := range entries {
+		path := fmt.Sprintf("schedule[%d]", i)
+		if e.Name == "" {
+			problems.add(file, path+".name", "required")
+		} else if names[e.Name] {
+			problems.add(file, path+".name", "duplicate name \"%s\"", e.Name)
+		}
+		names[e.Name] = true
+
+		if e.Cron == "" {
+			problems.add(file, path+".cron", "required")
+		} else if c, err := parseCron(e.Cron); err != nil {
+			problems.add(file, path+".cron", "invalid cron expression \"%s\": %s", e.Cron, err)
+		} else if c.next(time.Now()).IsZero() {
+			problems.add(file, path+".cron", "cron expression \"%s\" never matches", e.Cron)
+		}
+		if _, ok := actions[e.Action]; !ok {
+			problems.add(file, path+".action", "unknown action \"%s\"", e.Action)
+		}
+	}
+}
+
+// scheduleRun is the last run of an entry.
+type scheduleRun struct {
+	time time.Time
+	err  error
+}
+
+var (
+	scheduleMutex sync.Mutex
+	scheduleRuns  = make(map[string]scheduleRun)
+)
+
+// scheduleStatus is an entry in the status, with its next and last run.
+type scheduleStatus struct {
+	Name    string     `json:"name"`
+	Action  string     `json:"action"`
+	Args    []string   `json:"args,omitempty"`
+	Next    *time.Time `json:"next,omitempty"`
+	LastRun *time.Time `json:"last_run,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// scheduleStatuses requires configMutex to be held.
+func scheduleStatuses() []scheduleStatus {
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+
+	var statuses []scheduleStatus
+	now := time.Now()
+	for _, e := range cfg.Schedule {
+		s := scheduleStatus{Name: e.Name, Action: e.Action, Args: e.Args}
+		if c, err := parseCron(e.Cron); err == nil {
+			if next := c.next(now); !next.IsZero() {
+				s.Next = &next
+			}
+		}
+		if r, ok := scheduleRuns[e.Name]; ok {
+			last := r.time
+			s.LastRun = &last
+			if r.err != nil {
+				s.Error = r.err.Error()
+			}
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+func runScheduled(e scheduleEntry, t time.Time) {
+	scheduleLog.Infof("Run scheduled \"%s\": action \"%s\" %q\n", e.Name, e.Action, e.Args)
+	_, err := runAction(sourceSchedule, e.Action, e.Args)
+	if err != nil {
+		scheduleLog.Errorf("Scheduled \"%s\" failed: %s\n", e.Name, err)
+		notify(notifyScheduleFailed, "CenCtl: scheduled action failed", fmt.Sprintf("\"%s\": %s", e.Name, err))
+	}
+
+	scheduleMutex.Lock()
+	scheduleRuns[e.Name] = scheduleRun{time: t, err: err}
+	scheduleMutex.Unlock()
+}
+
+// runSchedule runs the entries matching each minute. Minutes passed
+// while the computer was asleep are not caught up.
+func runSchedule() {
+	last := time.Now().Truncate(time.Minute)
+	for now := range time.Tick(time.Second) {
+		minute := now.Truncate(time.Minute)
+		if !minute.After(last) {
+			continue
+		}
+		last = minute
+
+		configMutex.RLock()
+		entries := append([]scheduleEntry(nil), cfg.Schedule...)
+		configMutex.RUnlock()
+
+		for _, e := range entries {
+			c, err := parseCron(e.Cron)
+			if err != nil || !c.match(minute) {
+				continue
+			}
+			go runScheduled(e, minute)
+		}
+	}
+}
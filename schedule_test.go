@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr string
+		ok   bool
+	}{
+		{"* * * * *", true},
+		{"*/15 9-17 * * mon-fri", true},
+		{"0 0 1,15 jan,JUL 0", true},
+		{"5/10 * * * 7", true},
+		{"@daily", true},
+		{"@hourly", true},
+		{"* * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"*/0 * * * *", false},
+		{"10-5 * * * *", false},
+		{"* * * foo *", false},
+		{"@reboot", false},
+	}
+	for _, test := range tests {
+		_, err := parseCron(test.expr)
+		if (err == nil) != test.ok {
+			t.Errorf("parseCron(%q) error = %v, want ok %v", test.expr, err, test.ok)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	const layout = "2006-01-02 15:04"
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"* * * * *", "2024-03-01 10:00", "2024-03-01 10:01"},
+		{"*/15 * * * *", "2024-03-01 10:07", "2024-03-01 10:15"},
+		{"5/20 * * * *", "2024-03-01 10:30", "2024-03-01 10:45"},
+		{"0 9-17/4 * * *", "2024-03-01 13:00", "2024-03-01 17:00"},
+		{"30 8 * * mon-fri", "2024-03-01 09:00", "2024-03-04 08:30"},
+		{"0 0 * * 7", "2024-03-01 00:00", "2024-03-03 00:00"},
+		{"0 0 1 feb *", "2024-03-01 00:00", "2025-02-01 00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		// With both restricted, the day of month or the day of week.
+		{"0 0 13 * fri", "2024-03-01 00:00", "2024-03-08 00:00"},
+		{"0 0 13 * fri", "2024-03-09 00:00", "2024-03-13 00:00"},
+		// With one of them *, the other alone.
+		{"0 0 13 * *", "2024-03-01 00:00", "2024-03-13 00:00"},
+		{"0 0 * * fri", "2024-03-09 00:00", "2024-03-15 00:00"},
+		{"@monthly", "2024-12-15 12:00", "2025-01-01 00:00"},
+		{"0 0 30 2 *", "2024-01-01 00:00", ""},
+	}
+	for _, test := range tests {
+		c, err := parseCron(test.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q) error: %s", test.expr, err)
+			continue
+		}
+		from, _ := time.ParseInLocation(layout, test.from, time.UTC)
+		next := c.next(from)
+		got := ""
+		if !next.IsZero() {
+			got = next.Format(layout)
+		}
+		if got != test.want {
+			t.Errorf("next(%q, %s) = %q, want %q", test.expr, test.from, got, test.want)
+		}
+		if !next.IsZero() && !c.match(next) {
+			t.Errorf("%q does not match its next time %s", test.expr, got)
+		}
+	}
+}
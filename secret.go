@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const secretPrefix = "secret:"
+
+// Secret stores, set by "store" of the secrets section.
+const (
+	secretStoreOS    = "os"
+	secretStoreVault = "vault"
+)
+
+type secretsConfig struct {
+	Store string `json:"store"`
+	Vault string `json:"vault"`
+}
+
+// secretStore holds the secrets referred to by "secret:<name>" values.
+type secretStore interface {
+	get(name string) (string, error)
+	set(name, value string) error
+	remove(name string) error
+	list() ([]string, error)
+}
+
+// osStore is the Windows Credential Manager or the Linux Secret Service.
+type osStore struct{}
+
+func (osStore) get(name string) (string, error) { return osSecret(name) }
+func (osStore) set(name, value string) error    { return setOSSecret(name, value) }
+func (osStore) remove(name string) error        { return removeOSSecret(name) }
+func (osStore) list() ([]string, error)         { return listOSSecrets() }
+
+// secretsSection is the secrets section of the config, kept apart so
+// that the secrets are resolved without configMutex held.
+var (
+	secretsMutex   sync.Mutex
+	secretsSection secretsConfig
+)
+
+func setSecretsConfig(c secretsConfig) {
+	secretsMutex.Lock()
+	secretsSection = c
+	secretsMutex.Unlock()
+}
+
+func secretBackend() secretStore {
+	secretsMutex.Lock()
+	c := secretsSection
+	secretsMutex.Unlock()
+	if c.Store == secretStoreVault {
+		return vaultStore{file: vaultPath(c.Vault)}
+	}
+	return osStore{}
+}
+
+func validateSecrets(problems *configProblems, file string, c secretsConfig) {
+	switch c.Store {
+	case "", secretStoreOS, secretStoreVault:
+	default:
+		problems.add(file, "secrets.store", "invalid store \"%s\", expect os or vault", c.Store)
+	}
+	if c.Vault != "" && c.Store != secretStoreVault {
+		problems.add(file, "secrets.vault", "needs \"store\": \"vault\"")
+	}
+}
+
+func isSecretRef(s string) bool {
+	return strings.HasPrefix(s, secretPrefix)
+}
+
+// checkSecretRef tells if the value is a secret reference, and reports
+// one without a name.
+func checkSecretRef(problems *configProblems, file, path, value string) bool {
+	if !isSecretRef(value) {
+		return false
+	}
+	if value == secretPrefix {
+		problems.add(file, path, "missing secret name")
+	}
+	return true
+}
+
+// resolveSecret returns s, or the secret it refers to if it is
+// "secret:<name>".
+func resolveSecret(s string) (string, error) {
+	if !isSecretRef(s) {
+		return s, nil
+	}
+	name := strings.TrimPrefix(s, secretPrefix)
+	value, err := secretBackend().get(name)
+	if err != nil {
+		return "", fmt.Errorf("secret \"%s\": %s", name, err)
+	}
+	resolvedMutex.Lock()
+	resolved[value] = true
+	resolvedMutex.Unlock()
+	return value, nil
+}
+
+var (
+	resolvedMutex sync.Mutex
+	resolved      = make(map[string]bool)
+)
+
+// resolvedSecretValues returns the secrets resolved by this process,
+// redacted from the logs in the diagnostics.
+func resolvedSecretValues() []string {
+	resolvedMutex.Lock()
+	defer resolvedMutex.Unlock()
+	var values []string
+	for v := range resolved {
+		values = append(values, v)
+	}
+	return values
+}
+
+func resolveSecrets(values []string) ([]string, error) {
+	resolved := make([]string, len(values))
+	for i, v := range values {
+		s, err := resolveSecret(v)
+		if err != nil {
+			return nil, err
+		}
+		resolved[i] = s
+	}
+	return resolved, nil
+}
+
+// readSecretValue reads the value to store from the terminal without
+// echo, or from stdin.
+func readSecretValue() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Secret value: ")
+		value, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(value), err
+	}
+	value, err := ioutil.ReadAll(os.Stdin)
+	return strings.TrimRight(string(value), "\r\n"), err
+}
+
+// runSecretCLI runs the secret commands in the calling process, the
+// store is per user and the value is not sent to the running instance.
+func runSecretCLI(args []string) int {
+	usage := func() int {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	store := secretBackend()
+	start := time.Now()
+	var result interface{}
+	var err error
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		var names []string
+		if names, err = store.list(); err == nil {
+			result = names
+		}
+	case args[0] == "get" && len(args) == 2:
+		var value string
+		if value, err = store.get(args[1]); err == nil {
+			result = map[string]string{"name": args[1], "value": value}
+		}
+	case args[0] == "set" && (len(args) == 2 || len(args) == 3):
+		value := ""
+		if len(args) == 3 {
+			value = args[2]
+		} else if value, err = readSecretValue(); err != nil {
+			break
+		}
+		err = store.set(args[1], value)
+		recordAction(sourceCLI, "secret.set", args[1:2], start, err)
+	case args[0] == "remove" && len(args) == 2:
+		err = store.remove(args[1])
+		recordAction(sourceCLI, "secret.remove", args[1:2], start, err)
+	default:
+		return usage()
+	}
+
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	if *jsonOutput {
+		if result == nil {
+			result = map[string]string{}
+		}
+		printJSON(result)
+		return 0
+	}
+	switch r := result.(type) {
+	case []string:
+		for _, name := range r {
+			fmt.Println(name)
+		}
+	case map[string]string:
+		fmt.Println(r["value"])
+	}
+	return 0
+}
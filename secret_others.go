@@ -0,0 +1,61 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// osSecret looks up the secret in the Secret Service, as stored by
+// "secret-tool store --label=cenctl service cenctl name <name>".
+func osSecret(name string) (string, error) {
+	out, err := runCmdOutput("secret-tool", "lookup", "service", "cenctl", "name", name)
+	if err != nil {
+		return "", fmt.Errorf("lookup secret \"%s\": %s", name, err)
+	}
+	return strings.TrimRight(out, "\n"), nil
+}
+
+func setOSSecret(name, value string) error {
+	cmd := exec.Command("secret-tool", "store", "--label=cenctl "+name, "service", "cenctl", "name", name)
+	cmd.SysProcAttr = sysProcAttr()
+	cmd.Stdin = strings.NewReader(value)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("store secret \"%s\": %s %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func removeOSSecret(name string) error {
+	if _, err := osSecret(name); err != nil {
+		return err
+	}
+	if _, err := runCmdOutput("secret-tool", "clear", "service", "cenctl", "name", name); err != nil {
+		return fmt.Errorf("clear secret \"%s\": %s", name, err)
+	}
+	return nil
+}
+
+// listOSSecrets reads the "attribute.name = <name>" lines of the items
+// of cenctl.
+func listOSSecrets() ([]string, error) {
+	out, err := runCmdOutput("secret-tool", "search", "--all", "service", "cenctl")
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			// Nothing found
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("search secrets: %s", err)
+	}
+	names := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == "attribute.name" {
+			names = append(names, strings.TrimSpace(parts[1]))
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	advapi32, _          = syscall.LoadLibrary("advapi32.dll")
+	credReadProc, _      = syscall.GetProcAddress(advapi32, "CredReadW")
+	credWriteProc, _     = syscall.GetProcAddress(advapi32, "CredWriteW")
+	credDeleteProc, _    = syscall.GetProcAddress(advapi32, "CredDeleteW")
+	credEnumerateProc, _ = syscall.GetProcAddress(advapi32, "CredEnumerateW")
+	credFreeProc, _      = syscall.GetProcAddress(advapi32, "CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	credTargetPrefix        = "cenctl:"
+)
+
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// osSecret reads the generic credential "cenctl:<name>" from the Windows
+// Credential Manager, as stored by
+// "cmdkey /generic:cenctl:<name> /user:cenctl /pass".
+func osSecret(name string) (string, error) {
+	target, err := syscall.UTF16PtrFromString(credTargetPrefix + name)
+	if err != nil {
+		return "", err
+	}
+
+	var cred *credential
+	ret, _, callErr := syscall.Syscall6(uintptr(credReadProc), 4,
+		uintptr(unsafe.Pointer(target)),
+		credTypeGeneric,
+		0,
+		uintptr(unsafe.Pointer(&cred)),
+		0, 0)
+	if ret == 0 {
+		return "", fmt.Errorf("read credential \"%s%s\": %s", credTargetPrefix, name, callErr)
+	}
+	defer syscall.Syscall(uintptr(credFreeProc), 1, uintptr(unsafe.Pointer(cred)), 0, 0)
+
+	// cmdkey stores the password as UTF-16
+	n := int(cred.CredentialBlobSize) / 2
+	if n == 0 {
+		return "", nil
+	}
+	blob := (*[1 << 20]uint16)(unsafe.Pointer(cred.CredentialBlob))[:n:n]
+	return string(utf16.Decode(blob)), nil
+}
+
+// setOSSecret writes the credential as cmdkey does, with the password as
+// UTF-16.
+func setOSSecret(name, value string) error {
+	target, err := syscall.UTF16PtrFromString(credTargetPrefix + name)
+	if err != nil {
+		return err
+	}
+	user, err := syscall.UTF16PtrFromString("cenctl")
+	if err != nil {
+		return err
+	}
+	blob := utf16.Encode([]rune(value))
+
+	cred := credential{
+		Type:       credTypeGeneric,
+		TargetName: target,
+		Persist:    credPersistLocalMachine,
+		UserName:   user,
+	}
+	if len(blob) > 0 {
+		cred.CredentialBlobSize = uint32(len(blob) * 2)
+		cred.CredentialBlob = (*byte)(unsafe.Pointer(&blob[0]))
+	}
+	ret, _, callErr := syscall.Syscall(uintptr(credWriteProc), 2, uintptr(unsafe.Pointer(&cred)), 0, 0)
+	if ret == 0 {
+		return fmt.Errorf("write credential \"%s%s\": %s", credTargetPrefix, name, callErr)
+	}
+	return nil
+}
+
+func removeOSSecret(name string) error {
+	target, err := syscall.UTF16PtrFromString(credTargetPrefix + name)
+	if err != nil {
+		return err
+	}
+	ret, _, callErr := syscall.Syscall(uintptr(credDeleteProc), 3, uintptr(unsafe.Pointer(target)), credTypeGeneric, 0)
+	if ret == 0 {
+		return fmt.Errorf("delete credential \"%s%s\": %s", credTargetPrefix, name, callErr)
+	}
+	return nil
+}
+
+// listOSSecrets enumerates the credentials "cenctl:*".
+func listOSSecrets() ([]string, error) {
+	filter, err := syscall.UTF16PtrFromString(credTargetPrefix + "*")
+	if err != nil {
+		return nil, err
+	}
+
+	var count uint32
+	var creds **credential
+	ret, _, callErr := syscall.Syscall6(uintptr(credEnumerateProc), 4,
+		uintptr(unsafe.Pointer(filter)),
+		0,
+		uintptr(unsafe.Pointer(&count)),
+		uintptr(unsafe.Pointer(&creds)),
+		0, 0)
+	names := []string{}
+	if ret == 0 {
+		if callErr == syscall.ERROR_NOT_FOUND {
+			return names, nil
+		}
+		return nil, fmt.Errorf("enumerate credentials: %s", callErr)
+	}
+	defer syscall.Syscall(uintptr(credFreeProc), 1, uintptr(unsafe.Pointer(creds)), 0, 0)
+
+	list := (*[1 << 16]*credential)(unsafe.Pointer(creds))[:count:count]
+	for _, cred := range list {
+		if cred.Type != credTypeGeneric {
+			continue
+		}
+		target := syscall.UTF16ToString((*[1 << 15]uint16)(unsafe.Pointer(cred.TargetName))[:])
+		names = append(names, strings.TrimPrefix(target, credTargetPrefix))
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,105 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var serviceLog = componentLogger("service")
+
+const serviceName = "cenctl"
+
+// unitTemplate has no After=network-online.target, the user manager
+// does not see the targets of the system. The networks are followed by
+// the daemon itself.
+const unitTemplate = `[Unit]
+Description=Center Control: VM, procs and v2ray
+
+[Service]
+ExecStart=%s --service
+KillSignal=SIGTERM
+TimeoutStopSec=90
+
+[Install]
+WantedBy=default.target
+`
+
+// systemdQuote quotes s as a word of a systemd command line, where %
+// starts a specifier and $ a variable.
+func systemdQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$")
+	return `"` + r.Replace(s) + `"`
+}
+
+func runService() {
+	serviceLog.Infof("Run as systemd service")
+	restoreProxy()
+	startDaemon()
+	runHeadless()
+}
+
+func unitPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "systemd", "user", serviceName+".service"), nil
+}
+
+func systemctl(arg ...string) error {
+	out, err := runCmdOutput("systemctl", append([]string{"--user"}, arg...)...)
+	if err != nil {
+		return fmt.Errorf("systemctl %v: %s %s", arg, err, out)
+	}
+	return nil
+}
+
+func installService() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		return err
+	}
+
+	unit, err := unitPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(unit), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(unit, []byte(fmt.Sprintf(unitTemplate, systemdQuote(exe))), 0644); err != nil {
+		return err
+	}
+	serviceLog.Infof("Systemd unit written to %s\n", unit)
+
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl("enable", "--now", serviceName+".service")
+}
+
+func uninstallService() error {
+	unit, err := unitPath()
+	if err != nil {
+		return err
+	}
+
+	if err := systemctl("disable", "--now", serviceName+".service"); err != nil {
+		serviceLog.Errorf("Disable unit error: %s\n", err)
+	}
+	if err := os.Remove(unit); err != nil {
+		return err
+	}
+	serviceLog.Infof("Systemd unit %s removed\n", unit)
+	return systemctl("daemon-reload")
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "testing"
+
+func TestSystemdQuote(t *testing.T) {
+	for s, want := range map[string]string{
+		"/usr/bin/cenctl":           `"/usr/bin/cenctl"`,
+		"/home/me/my apps/cenctl":   `"/home/me/my apps/cenctl"`,
+		`/opt/50%/"x"\$HOME/cenctl`: `"/opt/50%%/\"x\"\\$$HOME/cenctl"`,
+	} {
+		if got := systemdQuote(s); got != want {
+			t.Errorf("systemdQuote(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+var serviceLog = componentLogger("service")
+
+const (
+	serviceName        = "cenctl"
+	servicePasswordEnv = "CENCTL_SERVICE_PASSWORD"
+)
+
+var (
+	lsaOpenPolicyProc, _         = syscall.GetProcAddress(advapi32, "LsaOpenPolicy")
+	lsaAddAccountRightsProc, _   = syscall.GetProcAddress(advapi32, "LsaAddAccountRights")
+	lsaCloseProc, _              = syscall.GetProcAddress(advapi32, "LsaClose")
+	lsaNtStatusToWinErrorProc, _ = syscall.GetProcAddress(advapi32, "LsaNtStatusToWinError")
+)
+
+const (
+	policyCreateAccount = 0x10
+	policyLookupNames   = 0x800
+)
+
+type lsaUnicodeString struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        *uint16
+}
+
+type lsaObjectAttributes struct {
+	Length                   uint32
+	RootDirectory            uintptr
+	ObjectName               *lsaUnicodeString
+	Attributes               uint32
+	SecurityDescriptor       uintptr
+	SecurityQualityOfService uintptr
+}
+
+type service struct{}
+
+func (s *service) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	startDaemon()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for c := range r {
+		switch c.Cmd {
+		case svc.Interrogate:
+			changes <- c.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			serviceLog.Infof("Service stop requested")
+			changes <- svc.Status{State: svc.StopPending}
+			serviceLog.Infof("Poweroff VM")
+			poweroffVM(configSnapshot())
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+func runService() {
+	serviceLog.Infof("Run as Windows service")
+	if err := svc.Run(serviceName, &service{}); err != nil {
+		serviceLog.Errorf("Run service error: %s\n", err)
+	}
+}
+
+func installService() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err == nil {
+		s.Close()
+		return fmt.Errorf("service \"%s\" already exists", serviceName)
+	}
+
+	account, sid, err := currentAccount()
+	if err != nil {
+		return err
+	}
+	password, err := accountPassword(account)
+	if err != nil {
+		return err
+	}
+	if err := grantServiceLogon(sid); err != nil {
+		return fmt.Errorf("grant \"log on as a service\" to %s: %s", account, err)
+	}
+
+	s, err = m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName:      "CenCtl",
+		Description:      "Center Control: VM, procs and v2ray",
+		StartType:        mgr.StartAutomatic,
+		ServiceStartName: account,
+		Password:         password,
+	}, "--service")
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	serviceLog.Infof("Service \"%s\" installed for %s, run as %s\n", serviceName, exe, account)
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("start service as %s, check the password: %s", account, err)
+	}
+	return nil
+}
+
+// currentAccount returns the account installing the service, which it
+// runs as: the VirtualBox VMs and the Credential Manager are per user.
+func currentAccount() (string, *windows.SID, error) {
+	token, err := windows.OpenCurrentProcessToken()
+	if err != nil {
+		return "", nil, err
+	}
+	defer token.Close()
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return "", nil, err
+	}
+	sid, err := user.User.Sid.Copy()
+	if err != nil {
+		return "", nil, err
+	}
+	account, domain, _, err := sid.LookupAccount("")
+	if err != nil {
+		return "", nil, err
+	}
+	return domain + `\` + account, sid, nil
+}
+
+// accountPassword reads the password of the account from
+// CENCTL_SERVICE_PASSWORD, or asks it on the terminal.
+func accountPassword(account string) (string, error) {
+	if s := os.Getenv(servicePasswordEnv); s != "" {
+		return s, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return "", fmt.Errorf("password of %s required, set %s", account, servicePasswordEnv)
+	}
+	fmt.Fprintf(os.Stderr, "Password of %s, to run the service as: ", account)
+	password, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(password), nil
+}
+
+// grantServiceLogon gives the account the right to log on as a service,
+// which the Services console grants but CreateService does not.
+func grantServiceLogon(sid *windows.SID) error {
+	attrs := lsaObjectAttributes{}
+	attrs.Length = uint32(unsafe.Sizeof(attrs))
+	var policy uintptr
+	status, _, _ := syscall.Syscall6(uintptr(lsaOpenPolicyProc), 4,
+		0,
+		uintptr(unsafe.Pointer(&attrs)),
+		policyCreateAccount|policyLookupNames,
+		uintptr(unsafe.Pointer(&policy)),
+		0, 0)
+	if status != 0 {
+		return ntStatusError(status)
+	}
+	defer syscall.Syscall(uintptr(lsaCloseProc), 1, policy, 0, 0)
+
+	right := utf16.Encode([]rune("SeServiceLogonRight"))
+	name := lsaUnicodeString{
+		Length:        uint16(2 * len(right)),
+		MaximumLength: uint16(2 * len(right)),
+		Buffer:        &right[0],
+	}
+	status, _, _ = syscall.Syscall6(uintptr(lsaAddAccountRightsProc), 4,
+		policy,
+		uintptr(unsafe.Pointer(sid)),
+		uintptr(unsafe.Pointer(&name)),
+		1,
+		0, 0)
+	if status != 0 {
+		return ntStatusError(status)
+	}
+	return nil
+}
+
+func ntStatusError(status uintptr) error {
+	code, _, _ := syscall.Syscall(uintptr(lsaNtStatusToWinErrorProc), 1, status, 0, 0)
+	return syscall.Errno(code)
+}
+
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service \"%s\" is not installed", serviceName)
+	}
+	defer s.Close()
+
+	if _, err := s.Control(svc.Stop); err != nil {
+		serviceLog.Errorf("Stop service error: %s\n", err)
+	}
+
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	serviceLog.Infof("Service \"%s\" uninstalled\n", serviceName)
+	return nil
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+var startupLog = componentLogger("startup")
+
+const defaultStepTimeout = 2 * time.Minute
+
+// startupStep is a step of the startup plan. It runs an action or waits
+// for a condition. Without "after" a step runs after the previous one,
+// "after": [] makes it start right away.
+type startupStep struct {
+	Name    string   `json:"name"`
+	Action  string   `json:"action"`
+	Args    []string `json:"args"`
+	WaitFor string   `json:"wait_for"`
+	After   []string `json:"after"`
+	When    string   `json:"when"`
+	Delay   string   `json:"delay"`
+	Timeout string   `json:"timeout"`
+}
+
+// defaultStartupPlan starts the auto_start procs, and the VM after 30
+// seconds, all at the same time.
+func defaultStartupPlan() []startupStep {
+	var steps []startupStep
+	for _, p := range cfg.Proc {
+		if !p.AutoStart {
+			continue
+		}
+		steps = append(steps, startupStep{
+			Name:   "proc:" + p.Name,
+			Action: "proc.start",
+			Args:   []string{p.Name},
+			When:   "proc_stopped:" + p.Name,
+			After:  []string{},
+		})
+	}
+	steps = append(steps, startupStep{
+		Name:   "vm",
+		Action: "vm.start",
+		Delay:  "30s",
+		After:  []string{},
+	})
+	return steps
+}
+
+// startupPlan restores the saved state, or runs the startup plan of the
+// config.
+func startupPlan() []startupStep {
+	if s, ok := savedState(); ok {
+		startupLog.Infof("Restore the state saved at %s\n", s.Time.Format(time.RFC3339))
+		return restorePlan(s)
+	}
+	if cfg.Startup == nil {
+		return defaultStartupPlan()
+	}
+	return cfg.Startup
+}
+
+func (s startupStep) dependencies(prev string) []string {
+	if s.After != nil {
+		return s.After
+	}
+	if prev == "" {
+		return nil
+	}
+	return []string{prev}
+}
+
+func parseDuration(s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+func validateWhen(when string) error {
+	if when == "" {
+		return nil
+	}
+	cond, arg := splitCondition(when)
+	switch cond {
+	case "vm_running", "vm_stopped", "proxy_on", "proxy_off":
+		if arg == "" {
+			return nil
+		}
+	case "proc_running", "proc_stopped":
+		if arg != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid condition \"%s\"", when)
+}
+
+func validateWaitFor(waitFor string) error {
+	cond, arg := splitCondition(waitFor)
+	switch cond {
+	case "vm", "ssh":
+		if arg == "" {
+			return nil
+		}
+	case "tcp":
+		if _, _, err := net.SplitHostPort(arg); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid wait_for \"%s\", expect vm, ssh or tcp:<host:port>", waitFor)
+}
+
+func validateStartup(problems *configProblems, file string, steps []startupStep) {
+	names := make(map[string]bool)
+	prev := ""
+	for i, s := range steps {
+		path := fmt.Sprintf("startup[%d]", i)
+
+		if s.Name == "" {
+			problems.add(file, path+".name", "required")
+		} else if names[s.Name] {
+			problems.add(file, path+".name", "duplicate name \"%s\"", s.Name)
+		}
+
+		switch {
+		case s.Action != "" && s.WaitFor != "":
+			problems.add(file, path, "need only one of action or wait_for")
+		case s.Action != "":
+			if _, ok := actions[s.Action]; !ok {
+				problems.add(file, path+".action", "unknown action \"%s\"", s.Action)
+			}
+		case s.WaitFor != "":
+			if err := validateWaitFor(s.WaitFor); err != nil {
+				problems.add(file, path+".wait_for", "%s", err)
+			}
+		default:
+			problems.add(file, path, "need one of action or wait_for")
+		}
+
+		for _, dep := range s.dependencies(prev) {
+			if !names[dep] {
+				problems.add(file, path+".after", "\"%s\" is not a step defined before", dep)
+			}
+		}
+		if err := validateWhen(s.When); err != nil {
+			problems.add(file, path+".when", "%s", err)
+		}
+		checkDuration(problems, file, path+".delay", s.Delay)
+		checkDuration(problems, file, path+".timeout", s.Timeout)
+
+		names[s.Name] = true
+		prev = s.Name
+	}
+}
+
+func splitCondition(s string) (string, string) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func checkCondition(when string) bool {
+	cond, arg := splitCondition(when)
+	switch cond {
+	case "vm_running":
+		return vmState() == "running"
+	case "vm_stopped":
+		return vmState() != "running"
+	case "proxy_on":
+		return ieProxyEnabled()
+	case "proxy_off":
+		return !ieProxyEnabled()
+	case "proc_running":
+		return processRunning(arg)
+	case "proc_stopped":
+		return !processRunning(arg)
+	}
+	return true
+}
+
+// sshReady checks that the SSH server answers with its banner, a bare
+// TCP connect also succeeds on a NAT port forward of a stopped VM.
+func sshReady(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	return err == nil && strings.HasPrefix(banner, "SSH-")
+}
+
+func tcpReady(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func waitUntil(waitFor string, timeout time.Duration) error {
+	cond, arg := splitCondition(waitFor)
+	deadline := time.Now().Add(timeout)
+	for {
+		var ready bool
+		switch cond {
+		case "vm":
+			ready = vmState() == "running"
+		case "ssh":
+			ready = sshReady(cfg.VBox.SSHHost)
+		case "tcp":
+			ready = tcpReady(arg)
+		}
+		if ready {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout after %s", timeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+var (
+	startupMutex    sync.Mutex
+	startupProgress string
+)
+
+func showStartupProgress(progress string) {
+	startupMutex.Lock()
+	startupProgress = progress
+	startupMutex.Unlock()
+
+	if trayMenu != nil {
+		systray.SetTooltip(trayTooltip())
+	}
+}
+
+func trayTooltip() string {
+	startupMutex.Lock()
+	defer startupMutex.Unlock()
+	if startupProgress == "" {
+		return "Center Control"
+	}
+	return "Center Control - " + startupProgress
+}
+
+func runStep(s startupStep) error {
+	if d := parseDuration(s.Delay, 0); d > 0 {
+		startupLog.Infof("Startup step \"%s\" waits %s\n", s.Name, d)
+		time.Sleep(d)
+	}
+	if s.When != "" && !checkCondition(s.When) {
+		startupLog.Infof("Startup step \"%s\" skipped, \"%s\" is false\n", s.Name, s.When)
+		return nil
+	}
+
+	timeout := parseDuration(s.Timeout, defaultStepTimeout)
+	if s.WaitFor != "" {
+		return waitUntil(s.WaitFor, timeout)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := runAction(sourceStartup, s.Action, s.Args)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("timeout after %s", timeout)
+	}
+}
+
+// runStartup runs the steps as soon as the steps they depend on have
+// succeeded. A step whose dependency failed is not run.
+func runStartup(steps []startupStep) {
+	startupLog.Infof("Run startup plan with %d steps\n", len(steps))
+
+	type result struct {
+		done chan struct{}
+		err  error
+	}
+	results := make(map[string]*result)
+	for _, s := range steps {
+		results[s.Name] = &result{done: make(chan struct{})}
+	}
+
+	var wg sync.WaitGroup
+	var countMutex sync.Mutex
+	finished := 0
+
+	prev := ""
+	for _, s := range steps {
+		deps := s.dependencies(prev)
+		prev = s.Name
+
+		wg.Add(1)
+		go func(s startupStep, deps []string) {
+			defer wg.Done()
+			r := results[s.Name]
+			defer close(r.done)
+
+			for _, dep := range deps {
+				d, ok := results[dep]
+				if !ok {
+					continue
+				}
+				<-d.done
+				if d.err != nil {
+					r.err = fmt.Errorf("dependency \"%s\" failed", dep)
+					startupLog.Warnf("Startup step \"%s\" not run: %s\n", s.Name, r.err)
+					return
+				}
+			}
+
+			countMutex.Lock()
+			showStartupProgress(fmt.Sprintf("startup %d/%d: %s", finished+1, len(steps), s.Name))
+			countMutex.Unlock()
+
+			startupLog.Infof("Startup step \"%s\" begins\n", s.Name)
+			r.err = runStep(s)
+			if r.err != nil {
+				startupLog.Errorf("Startup step \"%s\" failed: %s\n", s.Name, r.err)
+				notify(notifyStartupFailed, "CenCtl: startup step failed", fmt.Sprintf("Step \"%s\": %s", s.Name, r.err))
+			} else {
+				startupLog.Infof("Startup step \"%s\" done\n", s.Name)
+			}
+
+			countMutex.Lock()
+			finished++
+			countMutex.Unlock()
+		}(s, deps)
+	}
+
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		showStartupProgress(fmt.Sprintf("startup: %d of %d steps failed", failed, len(steps)))
+	} else {
+		showStartupProgress("")
+	}
+	startupLog.Infof("Startup plan finished")
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+var stateLog = componentLogger("state")
+
+const stateFilename = "state.json"
+
+// runtimeState is what the user chose last, restored on startup instead
+// of the auto_start procs and the startup plan.
+type runtimeState struct {
+	Time         time.Time `json:"time"`
+	Proxy        bool      `json:"proxy"`
+	ProxyAddress string    `json:"proxy_address,omitempty"`
+	V2ray        string    `json:"v2ray,omitempty"`
+	Procs        []string  `json:"procs"`
+	VM           bool      `json:"vm"`
+	Profile      string    `json:"profile,omitempty"`
+}
+
+var stateMutex sync.Mutex
+
+func statePath() string {
+	return path.Join(appDir, stateFilename)
+}
+
+// restoreStateEnabled is false with "restore_state": false, to start
+// from the config every time.
+func restoreStateEnabled() bool {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return cfg.RestoreState == nil || *cfg.RestoreState
+}
+
+func readState() (runtimeState, error) {
+	var s runtimeState
+	data, err := ioutil.ReadFile(statePath())
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("%s: %s", statePath(), err)
+	}
+	return s, nil
+}
+
+// savedState returns the state to restore, if there is one and it is
+// not disabled.
+func savedState() (runtimeState, bool) {
+	if !restoreStateEnabled() {
+		return runtimeState{}, false
+	}
+	s, err := readState()
+	if os.IsNotExist(err) {
+		return s, false
+	} else if err != nil {
+		stateLog.Errorf("Read state error, use the config: %s\n", err)
+		return s, false
+	}
+	return s, true
+}
+
+// updateState applies change to the state file. The systray connected
+// to the service writes the proxy and the service the rest, so the file
+// is read again each time.
+func updateState(change func(s *runtimeState)) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	s, err := readState()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			stateLog.Warnf("Read state error, write a new one: %s\n", err)
+		}
+		s = runtimeState{}
+		seedState(&s)
+	}
+	change(&s)
+	s.Time = time.Now()
+
+	data, err := json.MarshalIndent(&s, "", "  ")
+	if err != nil {
+		stateLog.Errorf("Marshal state error: %s\n", err)
+		return
+	}
+	tmp := statePath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		stateLog.Errorf("Write state error: %s\n", err)
+		return
+	}
+	if err := os.Rename(tmp, statePath()); err != nil {
+		os.Remove(tmp)
+		stateLog.Errorf("Write state error: %s\n", err)
+	}
+}
+
+// recordState saves the result of an action chosen by the user. The
+// actions run by the startup plan, the schedule, the networks, the
+// config reload, the health checks and on exit are not choices.
+func recordState(source, name string, args []string) {
+	if !userSources[source] {
+		return
+	}
+
+	switch name {
+	case "proxy.on":
+		updateState(func(s *runtimeState) {
+			s.Proxy = true
+			s.ProxyAddress = ""
+			if len(args) == 1 {
+				s.ProxyAddress = args[0]
+			}
+		})
+	case "proxy.off":
+		updateState(func(s *runtimeState) {
+			s.Proxy = false
+		})
+	case "vm.start", "vm.stop":
+		updateState(func(s *runtimeState) {
+			s.VM = name == "vm.start"
+		})
+	case "v2ray.switch", "proc.start", "proc.stop":
+		updateState(snapshotState)
+	case "profile.apply":
+		configMutex.RLock()
+		p, err := findProfile(args[0])
+		configMutex.RUnlock()
+		if err != nil {
+			return
+		}
+		updateState(func(s *runtimeState) {
+			snapshotState(s)
+			s.Profile = p.Name
+			if p.VM != nil {
+				s.VM = *p.VM
+			}
+			if p.Proxy != nil && runsHere("proxy.on") {
+				s.Proxy = *p.Proxy
+				s.ProxyAddress = p.ProxyAddress
+			}
+		})
+	}
+}
+
+// seedState fills a new state with what is running, so that the first
+// choice recorded does not save the procs and the VM as stopped.
+func seedState(s *runtimeState) {
+	snapshotState(s)
+	s.VM = vmState() == "running"
+	if runsHere("proxy.on") {
+		s.Proxy = ieProxyEnabled()
+	}
+}
+
+// snapshotState records the v2ray server and the procs running, or
+// being started.
+func snapshotState(s *runtimeState) {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	s.V2ray = currentV2rayConfig()
+	s.Procs = []string{}
+	for _, p := range cfg.Proc {
+		if procActive(procState(p.Name)) {
+			s.Procs = append(s.Procs, p.Name)
+		}
+	}
+}
+
+// restorePlan is the startup plan bringing back the saved state. The
+// procs and servers removed from the config since are left out.
+func restorePlan(s runtimeState) []startupStep {
+	var steps []startupStep
+	if s.V2ray != "" && s.V2ray != currentV2rayConfig() {
+		for _, v2rayItem := range cfg.V2ray.Config {
+			if v2rayItem.Address == s.V2ray {
+				steps = append(steps, startupStep{
+					Name:   "v2ray",
+					Action: "v2ray.switch",
+					Args:   []string{s.V2ray},
+					After:  []string{},
+				})
+			}
+		}
+	}
+	for _, p := range cfg.Proc {
+		if !contains(s.Procs, p.Name) {
+			continue
+		}
+		steps = append(steps, startupStep{
+			Name:   "proc:" + p.Name,
+			Action: "proc.start",
+			Args:   []string{p.Name},
+			When:   "proc_stopped:" + p.Name,
+			After:  []string{},
+		})
+	}
+	if s.VM {
+		steps = append(steps, startupStep{
+			Name:   "vm",
+			Action: "vm.start",
+			Delay:  "30s",
+			After:  []string{},
+		})
+	}
+	return steps
+}
+
+// restoreProxy sets the proxy as saved, or disables it.
+func restoreProxy() {
+	s, ok := savedState()
+	if !ok || !s.Proxy {
+		disableIEProxy()
+		return
+	}
+	addr := s.ProxyAddress
+	if addr == "" {
+		addr = defaultProxyAddr
+	}
+	stateLog.Infof("Restore the proxy with %s\n", addr)
+	enableIEProxy(addr)
+}
+
+// restoreProfile shows the saved profile as the current one.
+func restoreProfile() {
+	if s, ok := savedState(); ok && s.Profile != "" {
+		profileMutex.Lock()
+		currentProfile = s.Profile
+		profileMutex.Unlock()
+	}
+}
+
+func actionState(args []string) (interface{}, error) {
+	if err := checkArgs(args, 0, "state"); err != nil {
+		return nil, err
+	}
+	s, err := readState()
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no state saved, the config is used on startup")
+	}
+	return s, err
+}
+
+// actionStateClear removes the state file, so that the next start uses
+// the config.
+func actionStateClear(args []string) (interface{}, error) {
+	if err := checkArgs(args, 0, "state clear"); err != nil {
+		return nil, err
+	}
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if err := os.Remove(statePath()); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return nil, nil
+}
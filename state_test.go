@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// useTestConfig sets a config with the procs and v2ray servers, the
+// first server being the current one, until the returned function is
+// called.
+func useTestConfig(procs []string, servers ...string) func() {
+	oldCfg, oldV2ray := cfg, cfgV2ray
+	cfg = config{}
+	for _, name := range procs {
+		cfg.Proc = append(cfg.Proc, proc{Name: name, Path: name})
+	}
+	for _, address := range servers {
+		cfg.V2ray.Config = append(cfg.V2ray.Config, struct {
+			Address string `json:"address"`
+			Port    int    `json:"port"`
+			ID      string `json:"id"`
+		}{Address: address})
+	}
+	cfgV2ray = map[string]interface{}{
+		"outbounds": []interface{}{map[string]interface{}{
+			"settings": map[string]interface{}{
+				"vnext": []interface{}{map[string]interface{}{"address": servers[0]}},
+			},
+		}},
+	}
+	return func() { cfg, cfgV2ray = oldCfg, oldV2ray }
+}
+
+func TestRestorePlan(t *testing.T) {
+	defer useTestConfig([]string{"a", "b", "c"}, "host1", "host2")()
+
+	tests := []struct {
+		name  string
+		state runtimeState
+		want  []string
+	}{
+		{"empty", runtimeState{}, nil},
+		{"current server", runtimeState{V2ray: "host1"}, nil},
+		{"other server", runtimeState{V2ray: "host2"}, []string{"v2ray"}},
+		{"removed server", runtimeState{V2ray: "host9"}, nil},
+		{"procs in config order", runtimeState{Procs: []string{"c", "gone", "a"}}, []string{"proc:a", "proc:c"}},
+		{"everything", runtimeState{V2ray: "host2", Procs: []string{"b"}, VM: true}, []string{"v2ray", "proc:b", "vm"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, step := range restorePlan(test.state) {
+			got = append(got, step.Name)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: steps %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	steps := restorePlan(runtimeState{Procs: []string{"b"}})
+	if want := []string{"b"}; steps[0].Action != "proc.start" || !reflect.DeepEqual(steps[0].Args, want) || steps[0].When != "proc_stopped:b" {
+		t.Errorf("proc step = %+v", steps[0])
+	}
+}
+
+// useTestAppDir moves appDir to a new directory until the returned
+// function is called.
+func useTestAppDir(t *testing.T) func() {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "cenctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := appDir
+	appDir = dir
+	return func() {
+		appDir = old
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRecordState(t *testing.T) {
+	defer useTestAppDir(t)()
+	defer useTestConfig(nil, "host1")()
+
+	recordState(sourceStartup, "proxy.on", nil)
+	if _, err := readState(); !os.IsNotExist(err) {
+		t.Fatalf("state saved for the startup plan: %v", err)
+	}
+
+	recordState(sourceCLI, "proxy.on", []string{"127.0.0.1:1080"})
+	recordState(sourceTray, "vm.start", nil)
+	s, err := readState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Proxy || s.ProxyAddress != "127.0.0.1:1080" || !s.VM {
+		t.Errorf("state = %+v", s)
+	}
+}
+
+func TestSeedState(t *testing.T) {
+	defer useTestAppDir(t)()
+	defer useTestConfig([]string{"seed-a", "seed-b"}, "host1", "host2")()
+	setProcState("seed-a", procRunning)
+	setProcState("seed-b", procStopped)
+
+	recordState(sourceCLI, "proxy.off", nil)
+	s, err := readState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"seed-a"}; s.V2ray != "host1" || !reflect.DeepEqual(s.Procs, want) || s.Proxy {
+		t.Errorf("seeded state = %+v", s)
+	}
+
+	setProcState("seed-b", procRunning)
+	for _, source := range []string{sourceSchedule, sourceNetwork, sourceHealth, sourceConfig} {
+		recordState(source, "proc.start", []string{"seed-b"})
+	}
+	if s, _ := readState(); len(s.Procs) != 1 {
+		t.Errorf("state saved for an automatic action: %+v", s)
+	}
+	recordState(sourceAPI, "proc.start", []string{"seed-b"})
+	if s, _ := readState(); len(s.Procs) != 2 {
+		t.Errorf("state not saved for an API client: %+v", s)
+	}
+}
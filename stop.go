@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+)
+
+const defaultStopTimeout = 10 * time.Second
+
+func waitExited(name string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for processRunning(name) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return true
+}
+
+// stopProcess asks the processes with the name to exit, and kills them
+// if they are still running after the grace period. It returns when
+// they have exited.
+func stopProcess(name string, grace time.Duration) {
+	pids := processPIDs(name)
+	if len(pids) == 0 {
+		return
+	}
+
+	for _, pid := range pids {
+		terminateProcess(pid)
+	}
+	if waitExited(name, grace) {
+		return
+	}
+
+	procLog.Warnf("Process \"%s\" still running after %s, kill it\n", name, grace)
+	killProcess(name)
+	if !waitExited(name, defaultStopTimeout) {
+		procLog.Warnf("Process \"%s\" still running after kill\n", name)
+	}
+}
@@ -0,0 +1,73 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var sysLog = componentLogger("sys")
+
+const (
+	vboxManage = "VBoxManage"
+	v2rayExe   = "v2ray"
+)
+
+func sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+func processRunning(name string) bool {
+	cmd := exec.Command("pgrep", "-x", name)
+	return cmd.Run() == nil
+}
+
+func processPIDs(name string) []int {
+	out, err := runCmdOutput("pgrep", "-x", name)
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	for _, field := range strings.Fields(out) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+func terminateProcess(pid int) {
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		sysLog.Errorf("Send SIGTERM to %d error: %s\n", pid, err)
+	}
+}
+
+func killProcess(name string) {
+	runCmdAndWait("pkill", "-KILL", "-x", name)
+}
+
+func rebootPC() {
+	runCmd("systemctl", "reboot")
+}
+
+func shutdownPC() {
+	runCmd("systemctl", "poweroff")
+}
+
+func attachConsole() {
+}
+
+func showError(title, message string) {
+	fmt.Fprintf(os.Stderr, "%s:\n%s\n", title, message)
+	runCmdAndWait("notify-send", "--urgency=critical", title, message)
+}
+
+func openURL(url string) {
+	runCmd("xdg-open", url)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var sysLog = componentLogger("sys")
+
+var (
+	kernel32, _                     = syscall.LoadLibrary("kernel32.dll")
+	attachConsoleProc, _            = syscall.GetProcAddress(kernel32, "AttachConsole")
+	freeConsoleProc, _              = syscall.GetProcAddress(kernel32, "FreeConsole")
+	generateConsoleCtrlEventProc, _ = syscall.GetProcAddress(kernel32, "GenerateConsoleCtrlEvent")
+	setConsoleCtrlHandlerProc, _    = syscall.GetProcAddress(kernel32, "SetConsoleCtrlHandler")
+)
+
+const (
+	createNewProcessGroup = 0x00000200
+	ctrlBreakEvent        = 1
+)
+
+var (
+	consoleMutex    sync.Mutex
+	consoleAttached bool
+)
+
+const (
+	vboxManage = "C:\\Program Files\\Oracle\\VirtualBox\\VBoxManage.exe"
+	v2rayExe   = "wv2ray.exe"
+)
+
+// sysProcAttr hides the window and starts a new process group, so that a
+// CTRL_BREAK can be sent to the process alone.
+func sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{HideWindow: true, CreationFlags: createNewProcessGroup}
+}
+
+func processRunning(name string) bool {
+	cmd := exec.Command("tasklist", "/FI", "IMAGENAME eq "+name)
+	cmd.SysProcAttr = sysProcAttr()
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		sysLog.Errorf("Get output for tasklist error: %s\n", err)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		sysLog.Errorf("Run tasklist command error: %s\n", err)
+	}
+
+	started := false
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), name) {
+			started = true
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		sysLog.Errorf("Reading tasklist output error: %s\n", err)
+	}
+
+	err = cmd.Wait()
+	if err != nil {
+		sysLog.Errorf("Command finished with error: %s\n", err)
+	}
+
+	return started
+}
+
+func processPIDs(name string) []int {
+	out, err := runCmdOutput("tasklist", "/FO", "CSV", "/NH", "/FI", "IMAGENAME eq "+name)
+	if err != nil {
+		sysLog.Errorf("Run tasklist command error: %s\n", err)
+		return nil
+	}
+
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		// "INFO: No tasks are running..." is not CSV
+		return nil
+	}
+	var pids []int
+	for _, record := range records {
+		if len(record) < 2 || !strings.EqualFold(record[0], name) {
+			continue
+		}
+		if pid, err := strconv.Atoi(record[1]); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// terminateProcess asks the process to exit: WM_CLOSE for its windows,
+// and CTRL_BREAK for a console process started in its own group.
+func terminateProcess(pid int) {
+	runCmdAndWait("taskkill", "/PID", strconv.Itoa(pid))
+
+	consoleMutex.Lock()
+	defer consoleMutex.Unlock()
+	if consoleAttached {
+		// Sending the event needs to attach to the console of the
+		// process, which would lose the console of the command line.
+		return
+	}
+
+	ret, _, _ := syscall.Syscall(uintptr(attachConsoleProc), 1, uintptr(pid), 0, 0)
+	if ret == 0 {
+		return
+	}
+	syscall.Syscall(uintptr(setConsoleCtrlHandlerProc), 2, 0, 1, 0)
+	syscall.Syscall(uintptr(generateConsoleCtrlEventProc), 2, ctrlBreakEvent, uintptr(pid), 0)
+	syscall.Syscall(uintptr(freeConsoleProc), 0, 0, 0, 0)
+	syscall.Syscall(uintptr(setConsoleCtrlHandlerProc), 2, 0, 0, 0)
+}
+
+func killProcess(name string) {
+	runCmdAndWait("taskkill", "/IM", name, "/F")
+}
+
+func rebootPC() {
+	runCmd("cmd", "/C", "shutdown", "/t", "0", "/r")
+}
+
+func shutdownPC() {
+	runCmd("cmd", "/C", "shutdown", "/t", "0", "/s")
+}
+
+// attachConsole makes the output visible when cenctl is built with
+// "-H windowsgui" and run from a console.
+func attachConsole() {
+	consoleMutex.Lock()
+	defer consoleMutex.Unlock()
+
+	ret, _, _ := syscall.Syscall(uintptr(attachConsoleProc), 1, ^uintptr(0), 0, 0)
+	if ret == 0 {
+		return
+	}
+	consoleAttached = true
+	f, err := os.OpenFile("CONOUT$", os.O_RDWR, 0)
+	if err != nil {
+		return
+	}
+	os.Stdout = f
+	os.Stderr = f
+}
+
+var (
+	user32, _         = syscall.LoadLibrary("user32.dll")
+	messageBoxProc, _ = syscall.GetProcAddress(user32, "MessageBoxW")
+)
+
+const mbIconError = 0x10
+
+func showError(title, message string) {
+	titlePtr, _ := syscall.UTF16PtrFromString(title)
+	messagePtr, _ := syscall.UTF16PtrFromString(message)
+	syscall.Syscall6(uintptr(messageBoxProc), 4, 0,
+		uintptr(unsafe.Pointer(messagePtr)),
+		uintptr(unsafe.Pointer(titlePtr)),
+		mbIconError, 0, 0)
+}
+
+func openURL(url string) {
+	runCmd("rundll32", "url.dll,FileProtocolHandler", url)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tokenFilename   = "api.token"
+	tokenCookieName = "cenctl_token"
+	// nonceTTL is how long the nonce of a page opened in the browser can
+	// be exchanged for the cookie.
+	nonceTTL = 30 * time.Second
+)
+
+var (
+	tokenMutex sync.Mutex
+	apiToken   string
+)
+
+func tokenPath() string {
+	return path.Join(appDir, tokenFilename)
+}
+
+// createAPIToken makes sure the token of the install exists, readable
+// only by the account of the daemon. It is created on the first start
+// and kept, so that the clients started before a restart still work.
+func createAPIToken() error {
+	if _, err := readAPIToken(); err == nil {
+		return restrictToOwner(tokenPath())
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	tmp := tokenPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(token+"\n"), 0600); err != nil {
+		return err
+	}
+	if err := restrictToOwner(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, tokenPath()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// readAPIToken returns the token of the install, which the clients of
+// the control API send. Reading it requires the account of the daemon.
+func readAPIToken() (string, error) {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+	if apiToken != "" {
+		return apiToken, nil
+	}
+	data, err := ioutil.ReadFile(tokenPath())
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("%s: empty token", tokenPath())
+	}
+	apiToken = token
+	return token, nil
+}
+
+// requestToken returns the token sent with the request, in the
+// Authorization header by the CLI and the systray, or in the cookie of
+// the dashboard.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if c, err := r.Cookie(tokenCookieName); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+func validToken(token string) bool {
+	want, err := readAPIToken()
+	if err != nil || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+var (
+	nonceMutex sync.Mutex
+	nonces     = make(map[string]time.Time)
+)
+
+// newNonce returns a nonce to open a page of the API in the browser. The
+// token is not put in the URL, since the command line of the browser,
+// which has it, can be read by the other local users.
+func newNonce() (string, error) {
+	nonce, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	nonceMutex.Lock()
+	defer nonceMutex.Unlock()
+	for n, expiry := range nonces {
+		if time.Now().After(expiry) {
+			delete(nonces, n)
+		}
+	}
+	nonces[nonce] = time.Now().Add(nonceTTL)
+	return nonce, nil
+}
+
+// useNonce tells if the nonce was given by newNonce and has not expired,
+// and forgets it, so that it is used once.
+func useNonce(nonce string) bool {
+	nonceMutex.Lock()
+	defer nonceMutex.Unlock()
+	expiry, ok := nonces[nonce]
+	delete(nonces, nonce)
+	return ok && time.Now().Before(expiry)
+}
+
+// handleNonce gives a nonce to a client of the API with the token.
+func handleNonce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	nonce, err := newNonce()
+	if err != nil {
+		writeAPIResponse(w, http.StatusInternalServerError, nil, err)
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, nonce, nil)
+}
+
+// requestNonce asks a nonce to the running instance.
+func requestNonce() (string, error) {
+	req, err := http.NewRequest(http.MethodPost, "http://"+apiAddr()+"/nonce", nil)
+	if err != nil {
+		return "", err
+	}
+	if err := setAuthorization(req); err != nil {
+		return "", err
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	httpResp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer httpResp.Body.Close()
+
+	var resp apiResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return "", fmt.Errorf("%s", httpResp.Status)
+	}
+	if resp.Error != "" {
+		return "", fmt.Errorf("%s", resp.Error)
+	}
+	var nonce string
+	if err := json.Unmarshal(resp.Result, &nonce); err != nil {
+		return "", fmt.Errorf("decode response error: %s", err)
+	}
+	return nonce, nil
+}
+
+// browserURL returns the URL of a page of the API for the browser, with
+// a nonce of the running instance the page exchanges for the cookie.
+func browserURL(page string) string {
+	u := "http://" + apiAddr() + page
+	nonce, err := requestNonce()
+	if err != nil {
+		apiLog.Errorf("Get nonce for the browser error: %s\n", err)
+		return u
+	}
+	return u + "?nonce=" + nonce
+}
+
+// requireToken refuses the requests without the token. A page opened
+// with ?nonce= gets the token as a cookie, and is redirected to the URL
+// without it, for the browser history.
+func requireToken(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if nonce := r.URL.Query().Get("nonce"); nonce != "" && r.Method == http.MethodGet {
+			token, err := readAPIToken()
+			if err != nil || !useNonce(nonce) {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     tokenCookieName,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
+			q := r.URL.Query()
+			q.Del("nonce")
+			u := *r.URL
+			u.RawQuery = q.Encode()
+			http.Redirect(w, r, u.RequestURI(), http.StatusSeeOther)
+			return
+		}
+
+		if !validToken(requestToken(r)) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// setAuthorization adds the token to a request to the running instance.
+func setAuthorization(req *http.Request) error {
+	token, err := readAPIToken()
+	if err != nil {
+		return fmt.Errorf("read API token error: %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
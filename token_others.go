@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "os"
+
+func restrictToOwner(file string) error {
+	return os.Chmod(file, 0600)
+}
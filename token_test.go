@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequireTokenNonce(t *testing.T) {
+	defer useTestAppDir(t)()
+	defer func() { apiToken = "" }()
+	apiToken = ""
+	if err := createAPIToken(); err != nil {
+		t.Fatal(err)
+	}
+	token, err := readAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := requireToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(httptest.NewRequest(http.MethodPost, "/nonce", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("request without token: %d", w.Code)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/nonce", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if w := serve(r); w.Code != http.StatusOK {
+		t.Errorf("request with token: %d", w.Code)
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = serve(httptest.NewRequest(http.MethodGet, "/log?nonce="+nonce+"&lines=10", nil))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/log?lines=10" {
+		t.Fatalf("page with nonce: %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != token || !cookies[0].HttpOnly {
+		t.Fatalf("cookies %v", cookies)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/log?lines=10", nil)
+	r.AddCookie(cookies[0])
+	if w := serve(r); w.Code != http.StatusOK {
+		t.Errorf("page with cookie: %d", w.Code)
+	}
+
+	if w := serve(httptest.NewRequest(http.MethodGet, "/?nonce="+nonce, nil)); w.Code != http.StatusUnauthorized {
+		t.Errorf("nonce used twice: %d", w.Code)
+	}
+	if w := serve(httptest.NewRequest(http.MethodGet, "/?nonce="+token, nil)); w.Code != http.StatusUnauthorized {
+		t.Errorf("token as nonce: %d", w.Code)
+	}
+	if w := serve(httptest.NewRequest(http.MethodGet, "/?token="+token, nil)); w.Code != http.StatusUnauthorized {
+		t.Errorf("token in URL: %d", w.Code)
+	}
+
+	nonce, _ = newNonce()
+	nonceMutex.Lock()
+	nonces[nonce] = time.Now().Add(-time.Second)
+	nonceMutex.Unlock()
+	if useNonce(nonce) {
+		t.Error("expired nonce used")
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var usageLog = componentLogger("usage")
+
+const usageInterval = 5 * time.Second
+
+// usage is the CPU and memory used by a process or the VM. CPU is in
+// percent of all CPUs, Memory in bytes.
+type usage struct {
+	Name   string  `json:"name"`
+	PIDs   []int   `json:"pids,omitempty"`
+	CPU    float64 `json:"cpu"`
+	Memory uint64  `json:"memory"`
+}
+
+type resourceUsage struct {
+	Time  time.Time `json:"time"`
+	V2ray *usage    `json:"v2ray,omitempty"`
+	Proc  []usage   `json:"proc"`
+	VM    *usage    `json:"vm,omitempty"`
+}
+
+func (ru resourceUsage) procUsage(name string) *usage {
+	for i := range ru.Proc {
+		if ru.Proc[i].Name == name {
+			return &ru.Proc[i]
+		}
+	}
+	return nil
+}
+
+type cpuSample struct {
+	cpu  time.Duration
+	time time.Time
+}
+
+var (
+	usageMutex   sync.Mutex
+	lastUsage    resourceUsage
+	cpuSamples   = make(map[int]cpuSample)
+	vmMetricsSet bool
+)
+
+// processUsage sums the usage of the processes with the name. The CPU
+// is measured since the previous sample of each PID.
+func processUsage(name string) *usage {
+	pids := processPIDs(name)
+	if len(pids) == 0 {
+		return nil
+	}
+
+	u := &usage{Name: name, PIDs: pids}
+	now := time.Now()
+	for _, pid := range pids {
+		cpu, mem, err := processTimes(pid)
+		if err != nil {
+			usageLog.Debugf("Get usage of process %d error: %s\n", pid, err)
+			continue
+		}
+		u.Memory += mem
+
+		usageMutex.Lock()
+		prev, ok := cpuSamples[pid]
+		cpuSamples[pid] = cpuSample{cpu: cpu, time: now}
+		usageMutex.Unlock()
+		if ok && now.After(prev.time) {
+			u.CPU += 100 * float64(cpu-prev.cpu) / float64(now.Sub(prev.time)) / float64(runtime.NumCPU())
+		}
+	}
+	return u
+}
+
+// vmUsage reads the CPU and memory of the VM process from the metrics
+// of VirtualBox, which are set up on the first call.
+func vmUsage() *usage {
+	usageMutex.Lock()
+	set := vmMetricsSet
+	usageMutex.Unlock()
+	if !set {
+		period := strconv.Itoa(int(usageInterval / time.Second))
+		if _, err := runCmdOutput(vboxManage, "metrics", "setup", "--period", period, "--samples", "1", cfg.VBox.VMName); err != nil {
+			usageLog.Errorf("Set up VM metrics error: %s\n", err)
+			return nil
+		}
+		usageMutex.Lock()
+		vmMetricsSet = true
+		usageMutex.Unlock()
+	}
+
+	out, err := runCmdOutput(vboxManage, "metrics", "query", cfg.VBox.VMName, "CPU/Load/User,CPU/Load/Kernel,RAM/Usage/Used")
+	if err != nil {
+		return nil
+	}
+	u := &usage{Name: cfg.VBox.VMName}
+	found := false
+	for _, line := range strings.Split(out, "\n") {
+		metric, value, ok := parseVMMetric(line)
+		if !ok {
+			continue
+		}
+		switch metric {
+		case "CPU/Load/User", "CPU/Load/Kernel":
+			if f, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64); err == nil {
+				u.CPU += f
+				found = true
+			}
+		case "RAM/Usage/Used":
+			if kb, err := strconv.ParseUint(value, 10, 64); err == nil {
+				u.Memory = kb * 1024
+				found = true
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	return u
+}
+
+// parseVMMetric parses a line "<object> <metric> <value> [unit]" of
+// VBoxManage metrics query from the right, since the object, the VM name,
+// may have spaces.
+func parseVMMetric(line string) (metric, value string, ok bool) {
+	fields := strings.Fields(line)
+	if n := len(fields); n >= 4 && fields[n-1] == "kB" {
+		fields = fields[:n-1]
+	}
+	n := len(fields)
+	if n < 3 {
+		return "", "", false
+	}
+	return fields[n-2], strings.TrimSuffix(fields[n-1], ","), true
+}
+
+func sampleUsage(procs []proc) resourceUsage {
+	start := time.Now()
+	ru := resourceUsage{Time: start, V2ray: processUsage(v2rayExe)}
+	for _, p := range procs {
+		if u := processUsage(p.Name); u != nil {
+			ru.Proc = append(ru.Proc, *u)
+		}
+	}
+	if vmState() == "running" {
+		ru.VM = vmUsage()
+	}
+
+	usageMutex.Lock()
+	lastUsage = ru
+	for pid, s := range cpuSamples {
+		if s.time.Before(start) {
+			delete(cpuSamples, pid)
+		}
+	}
+	usageMutex.Unlock()
+	return ru
+}
+
+// currentUsage returns the last sample, or takes two samples a second
+// apart when the daemon is not sampling. The config must be locked.
+func currentUsage() resourceUsage {
+	usageMutex.Lock()
+	ru := lastUsage
+	usageMutex.Unlock()
+	if !ru.Time.IsZero() {
+		return ru
+	}
+
+	sampleUsage(cfg.Proc)
+	time.Sleep(time.Second)
+	return sampleUsage(cfg.Proc)
+}
+
+func formatUsage(u *usage) string {
+	return fmt.Sprintf("%.1f%% CPU, %s", u.CPU, formatBytes(u.Memory))
+}
+
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+}
+
+// usageMenuItems is the Status submenu, whose rows only show values.
+func usageMenuItems(ru resourceUsage) []*menuItem {
+	status := &menuItem{ID: "status", Title: "Status"}
+	add := func(label string, u *usage) {
+		title := label + ": not running"
+		if ru.Time.IsZero() {
+			title = label + ": -"
+		} else if u != nil {
+			title = label + ": " + formatUsage(u)
+		}
+		status.Children = append(status.Children, &menuItem{ID: "status:" + label, Title: title})
+	}
+
+	add("VM", ru.VM)
+	add("V2ray", ru.V2ray)
+	for _, p := range cfg.Proc {
+		add(p.Name, ru.procUsage(p.Name))
+	}
+	return []*menuItem{status}
+}
+
+// monitorUsage samples the usage of the daemon every usageInterval.
+func monitorUsage() {
+	for range time.Tick(usageInterval) {
+		configMutex.RLock()
+		procs := append([]proc(nil), cfg.Proc...)
+		configMutex.RUnlock()
+		sampleUsage(procs)
+	}
+}
+
+// updateUsageMenu shows the usage in the Status submenu, read from the
+// running instance in thin client mode.
+func updateUsageMenu() {
+	for range time.Tick(usageInterval) {
+		var ru resourceUsage
+		if thinClient {
+			result, err := callAPI("usage", nil)
+			if err == nil {
+				err = json.Unmarshal(result, &ru)
+			}
+			if err != nil {
+				usageLog.Errorf("Get usage error: %s\n", err)
+				continue
+			}
+		} else {
+			usageMutex.Lock()
+			ru = lastUsage
+			usageMutex.Unlock()
+		}
+
+		configMutex.RLock()
+		trayMenu.setItems("status", usageMenuItems(ru))
+		configMutex.RUnlock()
+	}
+}
+
+func actionUsage(args []string) (interface{}, error) {
+	if err := checkArgs(args, 0, "usage"); err != nil {
+		return nil, err
+	}
+	return currentUsage(), nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestParseVMMetric(t *testing.T) {
+	tests := []struct {
+		line   string
+		metric string
+		value  string
+		ok     bool
+	}{
+		{"centos     CPU/Load/User     1.50%", "CPU/Load/User", "1.50%", true},
+		{"centos     CPU/Load/Kernel   0.25%,", "CPU/Load/Kernel", "0.25%", true},
+		{"centos     RAM/Usage/Used    524288 kB", "RAM/Usage/Used", "524288", true},
+		{"My VM 7    RAM/Usage/Used    524288 kB", "RAM/Usage/Used", "524288", true},
+		{"My VM 7    CPU/Load/User     3.00%", "CPU/Load/User", "3.00%", true},
+		{"Object     Metric            Values", "Metric", "Values", true},
+		{"---------- ----------------- -------", "-----------------", "-------", true},
+		{"", "", "", false},
+		{"centos 1.50%", "", "", false},
+		{"centos kB", "", "", false},
+	}
+	for _, test := range tests {
+		metric, value, ok := parseVMMetric(test.line)
+		if metric != test.metric || value != test.value || ok != test.ok {
+			t.Errorf("%q: got %q, %q, %v, want %q, %q, %v", test.line, metric, value, ok, test.metric, test.value, test.ok)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var getProcessMemoryInfoProc, _ = syscall.GetProcAddress(kernel32, "K32GetProcessMemoryInfo")
+
+const processQueryLimitedInformation = 0x1000
+
+// processMemoryCounters is PROCESS_MEMORY_COUNTERS.
+type processMemoryCounters struct {
+	cb                         uint32
+	pageFaultCount             uint32
+	peakWorkingSetSize         uintptr
+	workingSetSize             uintptr
+	quotaPeakPagedPoolUsage    uintptr
+	quotaPagedPoolUsage        uintptr
+	quotaPeakNonPagedPoolUsage uintptr
+	quotaNonPagedPoolUsage     uintptr
+	pagefileUsage              uintptr
+	peakPagefileUsage          uintptr
+}
+
+func filetimeDuration(ft syscall.Filetime) time.Duration {
+	return time.Duration(uint64(ft.HighDateTime)<<32|uint64(ft.LowDateTime)) * 100
+}
+
+// processTimes returns the CPU time used by the process so far and its
+// working set.
+func processTimes(pid int) (time.Duration, uint64, error) {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer syscall.CloseHandle(h)
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return 0, 0, err
+	}
+
+	var counters processMemoryCounters
+	counters.cb = uint32(unsafe.Sizeof(counters))
+	ret, _, callErr := syscall.Syscall(getProcessMemoryInfoProc, 3,
+		uintptr(h), uintptr(unsafe.Pointer(&counters)), uintptr(counters.cb))
+	if ret == 0 {
+		return 0, 0, callErr
+	}
+	return filetimeDuration(kernel) + filetimeDuration(user), uint64(counters.workingSetSize), nil
+}
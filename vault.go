@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	defaultVaultFilename = "secrets.vault"
+	vaultPassphraseEnv   = "CENCTL_VAULT_PASSPHRASE"
+	vaultVersion         = 1
+)
+
+// Parameters of scrypt, as recommended for interactive logins in 2017.
+const (
+	scryptN       = 1 << 15
+	scryptR       = 8
+	scryptP       = 1
+	vaultKeySize  = 32
+	vaultSaltSize = 16
+)
+
+// vaultFile is the encrypted vault: the secrets as a JSON object,
+// encrypted with AES-256-GCM under a key derived from the passphrase
+// with scrypt.
+type vaultFile struct {
+	Version int    `json:"version"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// vaultStore keeps the secrets in a local file encrypted with a
+// passphrase, read from CENCTL_VAULT_PASSPHRASE or asked on the terminal.
+type vaultStore struct {
+	file string
+}
+
+// vaultKey is derived from the passphrase and vaultSalt on unlock and
+// kept, so that scrypt runs once and not on every secret read.
+var (
+	vaultMutex      sync.Mutex
+	vaultPassphrase []byte
+	vaultSalt       []byte
+	vaultKey        []byte
+)
+
+func vaultPath(file string) string {
+	if file == "" {
+		file = defaultVaultFilename
+	}
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(appDir, file)
+}
+
+// passphrase returns the passphrase of the vault, asked once. A new
+// vault asks it twice.
+func (v vaultStore) passphrase(confirm bool) ([]byte, error) {
+	if vaultPassphrase != nil {
+		return vaultPassphrase, nil
+	}
+	if s := os.Getenv(vaultPassphraseEnv); s != "" {
+		vaultPassphrase = []byte(s)
+		return vaultPassphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, fmt.Errorf("vault locked, no terminal to ask the passphrase: set %s in the environment of cenctl", vaultPassphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, "Vault passphrase: ")
+	p, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat the passphrase: ")
+		again, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		if string(again) != string(p) {
+			return nil, fmt.Errorf("passphrases do not match")
+		}
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+	vaultPassphrase = p
+	return p, nil
+}
+
+// key returns the key of the vault for the salt, derived only when the
+// salt is not the one of the kept key.
+func (v vaultStore) key(salt []byte, confirm bool) ([]byte, error) {
+	if vaultKey != nil && bytes.Equal(salt, vaultSalt) {
+		return vaultKey, nil
+	}
+	passphrase, err := v.passphrase(confirm)
+	if err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, vaultKeySize)
+	if err != nil {
+		return nil, err
+	}
+	vaultSalt, vaultKey = salt, key
+	return key, nil
+}
+
+// read decrypts the vault, which is empty if the file does not exist.
+func (v vaultStore) read() (map[string]string, error) {
+	data, err := ioutil.ReadFile(v.file)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var vf vaultFile
+	if err := json.Unmarshal(data, &vf); err != nil {
+		return nil, fmt.Errorf("%s: %s", v.file, err)
+	}
+	if vf.Version != vaultVersion {
+		return nil, fmt.Errorf("%s: unsupported version %d", v.file, vf.Version)
+	}
+	// Other parameters could make scrypt use any amount of memory.
+	if vf.N != scryptN || vf.R != scryptR || vf.P != scryptP || len(vf.Salt) != vaultSaltSize {
+		return nil, fmt.Errorf("%s: unsupported key derivation parameters", v.file)
+	}
+	key, err := v.key(vf.Salt, false)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(vf.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("%s: invalid nonce", v.file)
+	}
+	plain, err := gcm.Open(nil, vf.Nonce, vf.Data, nil)
+	if err != nil {
+		vaultPassphrase, vaultSalt, vaultKey = nil, nil, nil
+		return nil, fmt.Errorf("%s: wrong passphrase or damaged vault", v.file)
+	}
+
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("%s: %s", v.file, err)
+	}
+	return secrets, nil
+}
+
+// write encrypts the secrets with a new nonce, under the key of the
+// vault read before, or a new salt for a new vault.
+func (v vaultStore) write(secrets map[string]string) error {
+	_, statErr := os.Stat(v.file)
+	vf := vaultFile{Version: vaultVersion, N: scryptN, R: scryptR, P: scryptP, Salt: vaultSalt}
+	if vaultKey == nil || os.IsNotExist(statErr) {
+		vf.Salt = make([]byte, vaultSaltSize)
+		if _, err := rand.Read(vf.Salt); err != nil {
+			return err
+		}
+	}
+	key, err := v.key(vf.Salt, os.IsNotExist(statErr))
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	vf.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(vf.Nonce); err != nil {
+		return err
+	}
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	vf.Data = gcm.Seal(nil, vf.Nonce, plain, nil)
+
+	data, err := json.MarshalIndent(&vf, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := v.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, v.file); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (v vaultStore) get(name string) (string, error) {
+	vaultMutex.Lock()
+	defer vaultMutex.Unlock()
+	secrets, err := v.read()
+	if err != nil {
+		return "", err
+	}
+	value, ok := secrets[name]
+	if !ok {
+		return "", fmt.Errorf("secret \"%s\" not found in the vault", name)
+	}
+	return value, nil
+}
+
+func (v vaultStore) set(name, value string) error {
+	vaultMutex.Lock()
+	defer vaultMutex.Unlock()
+	secrets, err := v.read()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return v.write(secrets)
+}
+
+func (v vaultStore) remove(name string) error {
+	vaultMutex.Lock()
+	defer vaultMutex.Unlock()
+	secrets, err := v.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return fmt.Errorf("secret \"%s\" not found in the vault", name)
+	}
+	delete(secrets, name)
+	return v.write(secrets)
+}
+
+func (v vaultStore) list() ([]string, error) {
+	vaultMutex.Lock()
+	defer vaultMutex.Unlock()
+	secrets, err := v.read()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// useVaultPassphrase locks the vault, to be unlocked with the
+// passphrase from the environment.
+func useVaultPassphrase(t *testing.T, passphrase string) {
+	t.Helper()
+	vaultPassphrase, vaultSalt, vaultKey = nil, nil, nil
+	if err := os.Setenv(vaultPassphraseEnv, passphrase); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cenctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv(vaultPassphraseEnv)
+	defer func() { vaultPassphrase, vaultSalt, vaultKey = nil, nil, nil }()
+
+	v := vaultStore{file: filepath.Join(dir, "secrets.vault")}
+	useVaultPassphrase(t, "right")
+	if names, err := v.list(); err != nil || len(names) != 0 {
+		t.Fatalf("list of a new vault = %v, %v", names, err)
+	}
+	for name, value := range map[string]string{"vm/host_key": "key1", "v2ray/host1": "id1"} {
+		if err := v.set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := v.remove("v2ray/host1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.remove("v2ray/host1"); err == nil {
+		t.Error("removing a missing secret: no error")
+	}
+
+	useVaultPassphrase(t, "right")
+	if names, err := v.list(); err != nil || !reflect.DeepEqual(names, []string{"vm/host_key"}) {
+		t.Errorf("list = %v, %v", names, err)
+	}
+	if value, err := v.get("vm/host_key"); err != nil || value != "key1" {
+		t.Errorf("get = %q, %v", value, err)
+	}
+	// The key is kept once unlocked, the passphrase is not used again.
+	vaultPassphrase = []byte("wrong")
+	if value, err := v.get("vm/host_key"); err != nil || value != "key1" {
+		t.Errorf("get with the kept key = %q, %v", value, err)
+	}
+
+	useVaultPassphrase(t, "wrong")
+	if _, err := v.get("vm/host_key"); err == nil {
+		t.Error("get with a wrong passphrase: no error")
+	}
+	if vaultPassphrase != nil {
+		t.Error("wrong passphrase kept")
+	}
+	if err := v.set("x", "y"); err == nil {
+		t.Error("set with a wrong passphrase: no error")
+	}
+}
+
+func TestVaultParameters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cenctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv(vaultPassphraseEnv)
+	defer func() { vaultPassphrase, vaultSalt, vaultKey = nil, nil, nil }()
+
+	v := vaultStore{file: filepath.Join(dir, "secrets.vault")}
+	useVaultPassphrase(t, "right")
+	if err := v.set("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(v.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		edit func(vf *vaultFile)
+	}{
+		{"version", func(vf *vaultFile) { vf.Version = 2 }},
+		{"n", func(vf *vaultFile) { vf.N = 1 << 30 }},
+		{"r", func(vf *vaultFile) { vf.R = 1 }},
+		{"p", func(vf *vaultFile) { vf.P = 16 }},
+		{"salt", func(vf *vaultFile) { vf.Salt = vf.Salt[:4] }},
+		{"nonce", func(vf *vaultFile) { vf.Nonce = nil }},
+		{"data", func(vf *vaultFile) { vf.Data[0] ^= 1 }},
+	}
+	for _, test := range tests {
+		var vf vaultFile
+		if err := json.Unmarshal(data, &vf); err != nil {
+			t.Fatal(err)
+		}
+		test.edit(&vf)
+		edited, err := json.Marshal(&vf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(v.file, edited, 0600); err != nil {
+			t.Fatal(err)
+		}
+		useVaultPassphrase(t, "right")
+		if _, err := v.get("a"); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+'use strict';
+
+// action runs an action of the control API and returns its result.
+async function action(name, ...args) {
+  const resp = await fetch('/action', {
+    method: 'POST',
+    headers: {'Content-Type': 'application/json'},
+    body: JSON.stringify({action: name, args: args, source: 'dashboard'}),
+  });
+  if (resp.status === 401) {
+    throw new Error('Not authorized, open the dashboard from the CenCtl menu');
+  }
+  const body = await resp.json();
+  if (body.error) {
+    throw new Error(body.error);
+  }
+  return body.result;
+}
+
+function showError(err) {
+  const el = document.getElementById('error');
+  el.textContent = err ? err.message : '';
+  el.hidden = !err;
+}
+
+async function run(name, ...args) {
+  try {
+    showError(null);
+    const result = await action(name, ...args);
+    await refresh();
+    return result;
+  } catch (err) {
+    showError(err);
+  }
+}
+
+function cell(row, text, className) {
+  const td = row.insertCell();
+  td.textContent = text;
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+function button(td, text, onclick) {
+  const b = document.createElement('button');
+  b.textContent = text;
+  b.onclick = onclick;
+  td.appendChild(b);
+  td.appendChild(document.createTextNode(' '));
+}
+
+function formatUsage(u) {
+  if (!u) {
+    return '';
+  }
+  return u.cpu.toFixed(1) + '% CPU, ' + (u.memory / 1048576).toFixed(1) + ' MB';
+}
+
+let latencies = {};
+let procConfigs = [];
+
+async function refreshServers() {
+  const servers = await action('v2ray.list');
+  const tbody = document.getElementById('servers');
+  tbody.innerHTML = '';
+  for (const s of servers) {
+    const row = tbody.insertRow();
+    cell(row, s.current ? '✔' : '');
+    cell(row, s.address);
+    cell(row, s.port);
+    const l = latencies[s.address];
+    cell(row, l === undefined ? '' : l.error ? 'unreachable' : l.latency.toFixed(0) + ' ms',
+      l && l.error ? 'failed' : '');
+    const td = row.insertCell();
+    if (!s.current) {
+      button(td, 'Switch', () => run('v2ray.switch', s.address));
+    }
+    button(td, 'Edit', () => {
+      const f = document.getElementById('server-form');
+      f.old.value = s.address;
+      f.address.value = s.address;
+      f.port.value = s.port;
+      f.id.value = '';
+    });
+    if (!s.current) {
+      button(td, 'Remove', () => {
+        if (confirm('Remove server ' + s.address + '?')) {
+          run('v2ray.remove', s.address);
+        }
+      });
+    }
+  }
+}
+
+function refreshProcs(status, usage) {
+  const tbody = document.getElementById('procs');
+  tbody.innerHTML = '';
+  for (const p of status.proc || []) {
+    const row = tbody.insertRow();
+    cell(row, p.name);
+    cell(row, p.state, p.state);
+    cell(row, p.health || '', p.health);
+    cell(row, formatUsage((usage.proc || []).find(u => u.name === p.name)));
+    const td = row.insertCell();
+    if (p.state === 'running' || p.state === 'starting') {
+      button(td, 'Stop', () => run('proc.stop', p.name));
+    } else {
+      button(td, 'Start', () => run('proc.start', p.name));
+    }
+    button(td, 'Edit', () => editProc(p.name));
+    button(td, 'Remove', () => {
+      if (confirm('Remove proc ' + p.name + '?')) {
+        run('proc.remove', p.name);
+      }
+    });
+  }
+}
+
+function refreshProfiles(status, profiles) {
+  document.getElementById('profile-state').textContent = status.profile || '';
+  const td = document.getElementById('profiles');
+  td.innerHTML = '';
+  for (const p of profiles) {
+    if (!p.current) {
+      button(td, p.name, () => run('profile.apply', p.name));
+    }
+  }
+}
+
+function formatTime(t) {
+  return t ? new Date(t).toLocaleString() : '';
+}
+
+function refreshSchedule(status) {
+  const tbody = document.getElementById('schedule');
+  tbody.innerHTML = '';
+  for (const s of status.schedule || []) {
+    const row = tbody.insertRow();
+    cell(row, s.name);
+    cell(row, [s.action, ...(s.args || [])].join(' '));
+    cell(row, s.next ? formatTime(s.next) : 'never');
+    cell(row, s.error ? formatTime(s.last_run) + ': ' + s.error : formatTime(s.last_run),
+      s.error ? 'failed' : '');
+  }
+}
+
+function editProc(name) {
+  const p = procConfigs.find(c => c.name === name);
+  if (!p) {
+    return;
+  }
+  const f = document.getElementById('proc-form');
+  f.name.value = p.name;
+  f.path.value = p.path;
+  f.cwd.value = p.cwd || '';
+  f.depends_on.value = (p.depends_on || []).join(', ');
+  f.auto_start.checked = p.auto_start;
+  f.args.value = (p.args || []).join('\n');
+}
+
+async function refresh() {
+  try {
+    const [status, usage] = await Promise.all([action('status'), action('usage')]);
+    document.getElementById('vm-state').textContent = status.vm;
+    document.getElementById('vm-usage').textContent = formatUsage(usage.vm);
+    document.getElementById('proxy-state').textContent = status.proxy ? 'on' : 'off';
+    document.getElementById('v2ray-state').textContent = status.v2ray;
+    document.getElementById('v2ray-usage').textContent = formatUsage(usage.v2ray);
+    document.getElementById('startup-state').textContent = status.startup || 'done';
+    procConfigs = await action('proc.list');
+    refreshProcs(status, usage);
+    refreshSchedule(status);
+    refreshProfiles(status, await action('profile.list'));
+    await refreshServers();
+  } catch (err) {
+    showError(err);
+  }
+}
+
+async function ping() {
+  try {
+    const servers = await action('v2ray.ping');
+    latencies = {};
+    for (const s of servers) {
+      latencies[s.address] = s;
+    }
+    await refresh();
+  } catch (err) {
+    showError(err);
+  }
+}
+
+function lines(s) {
+  return s.split('\n').map(l => l.trim()).filter(l => l !== '');
+}
+
+document.getElementById('server-form').onsubmit = async e => {
+  e.preventDefault();
+  const f = e.target;
+  await run('v2ray.set', f.address.value, f.port.value, f.id.value, f.old.value);
+  f.reset();
+};
+
+document.getElementById('proc-form').onsubmit = async e => {
+  e.preventDefault();
+  const f = e.target;
+  const fields = {
+    path: f.path.value,
+    cwd: f.cwd.value || null,
+    depends_on: f.depends_on.value ? f.depends_on.value.split(',').map(s => s.trim()) : null,
+    auto_start: f.auto_start.checked || null,
+    args: f.args.value ? lines(f.args.value) : null,
+  };
+  await run('proc.set', f.name.value, JSON.stringify(fields));
+  f.reset();
+};
+
+document.getElementById('ping').onclick = ping;
+
+for (const b of document.querySelectorAll('button[data-action]')) {
+  b.onclick = () => run(b.dataset.action);
+}
+
+refresh();
+ping();
+setInterval(refresh, 5000);
@@ -0,0 +1,4 @@
+#!/bin/sh
+
+#go-bindata -pkg web -debug -o assets.go *.html *.js *.css
+go-bindata -pkg web -o assets.go *.html *.js *.css